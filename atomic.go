@@ -0,0 +1,105 @@
+package ugarit
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+)
+
+// Aborter is implemented by the book targets able to discard what was
+// written to them, like AtomicFile. The Abort method of the epub30 and
+// epub20 books calls it instead of Close.
+type Aborter interface {
+	Abort() error
+}
+
+// AtomicFile is a book target writing to a temporary file, next to the
+// final one, renamed to its final path by Close. So the file at path is
+// either the previous one or the complete new one, never a partial book,
+// even if the generator crashes.
+type AtomicFile struct {
+	f    *os.File
+	path string
+}
+
+// CreateAtomic creates an AtomicFile to be renamed to path when closed.
+// The temporary file is created with mode 0666 (before umask), like
+// os.Create does, unlike os.CreateTemp.
+func CreateAtomic(path string) (*AtomicFile, error) {
+	var name string
+
+	for i := 0; i < 10000; i++ {
+		name = filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%d.tmp", filepath.Base(path), rand.Uint32()))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &AtomicFile{f: f, path: path}, nil
+	}
+
+	return nil, &os.PathError{Op: "createtemp", Path: name, Err: os.ErrExist}
+}
+
+// Write writes to the temporary file.
+func (a *AtomicFile) Write(p []byte) (int, error) {
+	if a.f == nil {
+		return 0, os.ErrClosed
+	}
+	return a.f.Write(p)
+}
+
+// Close flushes the temporary file to disk and renames it to the final
+// path, keeping the mode of the file it replaces, if any (a new file gets
+// 0666 less the umask). On failure, the temporary file is removed and the
+// final path left untouched.
+func (a *AtomicFile) Close() error {
+	var err error
+
+	if a.f == nil {
+		return os.ErrClosed
+	}
+
+	if fi, err := os.Stat(a.path); err == nil {
+		err = a.f.Chmod(fi.Mode().Perm())
+		if err != nil {
+			a.Abort()
+			return err
+		}
+	}
+
+	err = a.f.Sync()
+	if err != nil {
+		a.Abort()
+		return err
+	}
+
+	err = a.f.Close()
+	if err == nil {
+		err = os.Rename(a.f.Name(), a.path)
+	}
+	if err != nil {
+		os.Remove(a.f.Name())
+	}
+	a.f = nil
+
+	return err
+}
+
+// Abort closes and removes the temporary file, leaving the final path
+// untouched.
+func (a *AtomicFile) Abort() error {
+	if a.f == nil {
+		return nil
+	}
+
+	a.f.Close()
+	err := os.Remove(a.f.Name())
+	a.f = nil
+
+	return err
+}
@@ -0,0 +1,29 @@
+package ugarit
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceDateEpoch is the environment variable which, set to a number of
+// seconds since the Unix epoch, makes the builds reproducible: the books are
+// stamped with this time instead of the current one (see
+// https://reproducible-builds.org/specs/source-date-epoch/).
+const SourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+// BuildTime returns the time the books are stamped with (modification date,
+// version, archive entries): the one set by the SourceDateEpoch environment
+// variable, if any, the current time otherwise. It is in UTC.
+func BuildTime() time.Time {
+	if s := strings.TrimSpace(os.Getenv(SourceDateEpoch)); s != "" {
+		sec, err := strconv.ParseInt(s, 10, 64)
+		if err == nil {
+			return time.Unix(sec, 0).UTC()
+		}
+		Goose.Logf(1, "BuildTime: invalid %s %q: %s\n", SourceDateEpoch, s, err)
+	}
+
+	return time.Now().UTC()
+}
@@ -0,0 +1,68 @@
+package ugarit
+
+import (
+	"strconv"
+)
+
+// Collection is a series or set the book belongs to: an EPUB 3
+// belongs-to-collection meta, with its collection-type and group-position
+// refinements, or the calibre:series and calibre:series_index metas of
+// EPUB 2 books.
+type Collection struct {
+	ID       string // meta id (EPUB 3 only)
+	Name     string
+	Type     string // "series" or "set"; EPUB 2 books only have series
+	Position string // position of the book in the collection, e.g. "2" or "2.5"
+}
+
+// Check tells whether the collection fields hold allowed values.
+func (c Collection) Check() error {
+	if c.Name == "" {
+		return ErrorInvalidCollection
+	}
+	switch c.Type {
+	case "", "series", "set":
+	default:
+		return ErrorInvalidCollection
+	}
+	if c.Position != "" {
+		if _, err := strconv.ParseFloat(c.Position, 64); err != nil {
+			return ErrorInvalidCollection
+		}
+	}
+	return nil
+}
+
+// epubCollections lists the collections declared by the metas.
+func epubCollections(metas []Meta) []Collection {
+	var res []Collection
+	var series, index string
+
+	for _, m := range metas {
+		switch {
+		case m.Property == "belongs-to-collection" && m.Refines == "":
+			res = append(res, Collection{
+				ID:       m.ID,
+				Name:     m.Value,
+				Type:     m.Refinement("collection-type"),
+				Position: m.Refinement("group-position"),
+			})
+		case m.Name == "calibre:series":
+			series = m.Content
+		case m.Name == "calibre:series_index":
+			index = m.Content
+		}
+	}
+
+	// Calibre also writes its metas into EPUB 3 books
+	if series != "" {
+		for _, c := range res {
+			if c.Name == series {
+				return res
+			}
+		}
+		res = append(res, Collection{Name: series, Type: "series", Position: index})
+	}
+
+	return res
+}
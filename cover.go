@@ -0,0 +1,130 @@
+package ugarit
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Cover returns the cover image of the book and a reader for it.
+func (er *epubReader) Cover() (DocMeta, io.Reader, error) {
+	var page DocMeta
+	var found bool
+
+	// candidates are tried in the order the EPUB 3, EPUB 2 and guide
+	// conventions are listed in the interface documentation.
+	candidates := []func() (DocMeta, bool){
+		func() (DocMeta, bool) {
+			for _, e := range er.entries {
+				for _, p := range e.meta.Properties {
+					if p == "cover-image" {
+						return e.meta, true
+					}
+				}
+			}
+			return DocMeta{}, false
+		},
+		func() (DocMeta, bool) {
+			for _, m := range er.metadata.Meta {
+				if m.Name == "cover" && m.Content != "" {
+					return er.Item(m.Content)
+				}
+			}
+			return DocMeta{}, false
+		},
+		func() (DocMeta, bool) {
+			for _, ref := range er.guide {
+				if strings.EqualFold(ref.Type, "cover") {
+					return er.ItemByPath(ref.Href)
+				}
+			}
+			return DocMeta{}, false
+		},
+	}
+
+	for _, candidate := range candidates {
+		dm, ok := candidate()
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(dm.MimeType, "image/") {
+			Goose.Logf(3, "Cover: found %s\n", dm.Path)
+			return er.coverReader(dm)
+		}
+		if !found && epubIsXHTML(dm.MimeType) {
+			page, found = dm, true
+		}
+	}
+
+	if !found {
+		Goose.Logf(2, "Cover: no cover declared\n")
+		return DocMeta{}, nil, ErrorCoverNotFound
+	}
+
+	Goose.Logf(3, "Cover: looking for an image in cover page %s\n", page.Path)
+
+	doc, err := er.Doc(page.Path)
+	if err != nil {
+		return DocMeta{}, nil, err
+	}
+
+	for _, n := range doc.Nodes {
+		if src := epubFirstImage(n); src != "" {
+			dm, ok := er.ItemByPath(er.Resolve(page.Path, src))
+			if ok {
+				Goose.Logf(3, "Cover: found %s in %s\n", dm.Path, page.Path)
+				return er.coverReader(dm)
+			}
+			Goose.Logf(1, "Cover: image %s of %s not in manifest\n", src, page.Path)
+			return DocMeta{}, nil, ErrorCoverNotFound
+		}
+	}
+
+	// An inline SVG cover has no separate image file.
+	return er.coverReader(page)
+}
+
+func (er *epubReader) coverReader(dm DocMeta) (DocMeta, io.Reader, error) {
+	r, err := er.DocReader(dm.Path)
+	if err != nil {
+		return DocMeta{}, nil, err
+	}
+	return dm, r, nil
+}
+
+// epubFirstImage returns the image reference of the first <img> or SVG
+// <image> element found under n, in document order.
+func epubFirstImage(n *html.Node) string {
+	if n.Type == html.ElementNode {
+		switch strings.ToLower(n.Data) {
+		case "img":
+			for _, a := range n.Attr {
+				if a.Key == "src" {
+					return a.Val
+				}
+			}
+		case "image", "svg:image":
+			// The HTML parser splits xlink:href into namespace and key
+			// inside <svg>, but keeps it whole under a svg: prefix.
+			for _, a := range n.Attr {
+				if a.Key == "href" || a.Key == "xlink:href" {
+					return a.Val
+				}
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if src := epubFirstImage(c); src != "" {
+			return src
+		}
+	}
+
+	return ""
+}
+
+// epubIsXHTML tells if mimetype names an (X)HTML document.
+func epubIsXHTML(mimetype string) bool {
+	return mimetype == "application/xhtml+xml" || mimetype == "text/html"
+}
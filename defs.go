@@ -59,25 +59,22 @@ type Book interface {
    // Closes the Ebook
    Close() error
 
-   /*
-      //Remove removes path
-      Remove(path string) error
+   // Remove removes path
+   Remove(path string) error
 
-      // RemoveAll removes path and any children it contains. It removes everything it can
-      // but returns the first error it encounters. If the path does not exist, RemoveAll
-      // returns nil (no error).
-      RemoveAll(path string) error
+   // RemoveAll removes path and any children it contains. It removes everything it can
+   // but returns the first error it encounters. If the path does not exist, RemoveAll
+   // returns nil (no error).
+   RemoveAll(path string) error
 
-      //Rename renames (moves) oldpath to newpath
-      Rename(oldpath, newpath string) error
+   // Rename renames (moves) oldpath to newpath
+   Rename(oldpath, newpath string) error
 
-      // Opens path...
-      Open(path string) (io.reader, error)
+   // Open opens path for reading
+   Open(path string) (io.Reader, error)
 
-      // List all files (absolute pathnames) in the ebook
-      AllFiles() []string
-
-   */
+   // AllFiles lists all files (absolute pathnames) in the ebook
+   AllFiles() []string
 }
 
 type IndexGenerator interface {
@@ -188,37 +185,51 @@ func (ss LowerLetterNumbering) Prefix() string {
 
 func (ss ArabicNumbering) Number(root string, number int) string {
    if ss.hierarchy {
-      return fmt.Sprintf("%s.%d", root, number)
+      return subNumber(root, fmt.Sprintf("%d", number))
    }
    return fmt.Sprintf("%d", number)
 }
 
 func (ss UpperRomanNumbering) Number(root string, number int) string {
    if ss.hierarchy {
-      return fmt.Sprintf("%s.%s", root, roman.Roman(number))
+      return subNumber(root, roman.Roman(number))
    }
    return fmt.Sprintf("%s", roman.Roman(number))
 }
 
 func (ss LowerRomanNumbering) Number(root string, number int) string {
    if ss.hierarchy {
-      return fmt.Sprintf("%s.%s", root, strings.ToLower(roman.Roman(number)))
+      return subNumber(root, strings.ToLower(roman.Roman(number)))
    }
    return fmt.Sprintf("%s", strings.ToLower(roman.Roman(number)))
 }
 
+// Number returns the letter of the section: number is 1-based, so 1 is "A".
+// Under a parent section numbered root, with hierarchy set, it is appended
+// to root.
 func (ss UpperLetterNumbering) Number(root string, number int) string {
    if ss.hierarchy {
-      return fmt.Sprintf("%s.%c", root, 'A'+number)
+      return subNumber(root, fmt.Sprintf("%c", 'A'+number-1))
    }
-   return fmt.Sprintf("%c", 'A'+number)
+   return fmt.Sprintf("%c", 'A'+number-1)
 }
 
+// Number returns the letter of the section: number is 1-based, so 1 is "a".
+// Under a parent section numbered root, with hierarchy set, it is appended
+// to root.
 func (ss LowerLetterNumbering) Number(root string, number int) string {
    if ss.hierarchy {
-      return fmt.Sprintf("%s.%c", root, 'a'+number)
+      return subNumber(root, fmt.Sprintf("%c", 'a'+number-1))
    }
-   return fmt.Sprintf("%c", 'a'+number)
+   return fmt.Sprintf("%c", 'a'+number-1)
+}
+
+// subNumber appends number to the number of the parent section, if any
+func subNumber(root, number string) string {
+   if root == "" {
+      return number
+   }
+   return root + "." + number
 }
 
 func NewArabicNumbering(prefix string, useHierarchy bool) ArabicNumbering {
@@ -246,4 +257,16 @@ var ErrorInvalidPathname error = errors.New("Invalid pathname")
 var ErrorTOCItemTitleNotFound error = errors.New("TOC item title not found")
 var ErrorReservedId error = errors.New("Reserved Id")
 var ErrorAlreadyTopLevel = errors.New("Error already top level")
-
+var ErrorCoverNotFound error = errors.New("Cover not found")
+var ErrorFileNotFound error = errors.New("File not found")
+var ErrorFileExists error = errors.New("File already exists")
+var ErrorElementNotFound error = errors.New("Element not found")
+var ErrorUnknownObfuscation error = errors.New("Unknown obfuscation algorithm")
+var ErrorInvalidUUID error = errors.New("Invalid UUID")
+var ErrorUnknownFontType error = errors.New("Unknown font type")
+var ErrorInvalidCollection error = errors.New("Invalid collection")
+var ErrorInvalidISBN error = errors.New("Invalid ISBN")
+var ErrorUnknownIdentifier error = errors.New("Unknown identifier")
+var ErrorAborted error = errors.New("Book aborted")
+var ErrorBookClosed error = errors.New("Book already closed")
+var ErrorDuplicateID error = errors.New("Id already in use")
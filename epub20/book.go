@@ -2,6 +2,7 @@ package epub20
 
 import (
    "archive/zip"
+   "bytes"
    "encoding/xml"
    "fmt"
    "github.com/luisfurquim/ugarit"
@@ -11,6 +12,7 @@ import (
    "io/ioutil"
    "path/filepath"
    "strings"
+   "time"
 )
 
 // Create a blank EPub Book
@@ -36,29 +38,6 @@ func New(
    b.index = make([]*TOCContent, 0, 4)
    b.cwd = "/"
    b.fd = target
-   b.zfd = zip.NewWriter(target)
-
-   header := &zip.FileHeader{
-      Name:   "mimetype",
-      Method: zip.Store,
-   }
-   f, err := b.zfd.CreateHeader(header)
-   if err != nil {
-      return nil, err
-   }
-   _, err = f.Write([]byte("application/epub+zip"))
-   if err != nil {
-      return nil, err
-   }
-
-   f, err = b.zfd.Create("META-INF/container.xml")
-   if err != nil {
-      return nil, err
-   }
-   _, err = f.Write([]byte(fmt.Sprintf(rootfolder, b.RootFolder)))
-   if err != nil {
-      return nil, err
-   }
 
    if len(metatag) > 0 {
       if len(Language) > 0 {
@@ -78,12 +57,16 @@ func New(
          Data: id,
          ID:   "pub-id",
       }
+      if i > 0 {
+         ids[i].ID = fmt.Sprintf("pub-id%d", i)
+      }
    }
 
    b.Package = Package{
-      Version: "2.0",
-      Xmlns:   "http://www.idpf.org/2007/opf",
-      UID:     "pub-id",
+      Version:  "2.0",
+      Xmlns:    "http://www.idpf.org/2007/opf",
+      XmlnsOpf: "http://www.idpf.org/2007/opf",
+      UID:      "pub-id",
       Metadata: Metadata{
          Xmlns:      "http://purl.org/dc/elements/1.1/",
          Title:      Title,
@@ -105,7 +88,7 @@ func New(
       b.Package.Spine.PageProgression = PageProgression
    }
 
-   b.subSection = ugarit.NewArabicNumbering("Chapter", true)
+   b.files = map[string]*file{}
 
    return &b, nil
 }
@@ -113,12 +96,59 @@ func New(
 // AddPage saves the page to the E-Book and adds an entry in the TOC pointing to it
 // It calls AddFile. So, if you use this method, you don't need to call AddFile to save it
 // otherwise it will be stored twice in the E-Book file.
+// Adding a page already in the book (e.g. patching a page of a book loaded by
+// Open) replaces its contents and its TOC entry, keeping its place in the
+// spine.
+// The page gets a TOC entry only if the EPubOptions object has a
+// TOCItemTitle (required by TOCTitle, TOC and Headings).
+// If the EPubOptions object has a Landmark, the page gets a guide reference
+// of the matching type (EPUB 2 has no epub:type).
+// If the EPubOptions object has Headings, TOC entries pointing to the page
+// headings are nested under the page entry (see addHeadings); headings
+// without an id get one.
 func (b *Book) AddPage(path string, mimetype string, src io.Reader, id string, options interface{}) (string, io.Writer, ugarit.TOCRef, error) {
    var w io.Writer
    var err error
    var opt *EPubOptions
    var pos int
    var tc *TOCContent
+   var heads []ugarit.Heading
+   var data []byte
+   var page *TOCContent
+   var existed bool
+
+   if b.err != nil {
+      return "", nil, nil, b.err
+   }
+
+   if options != nil {
+      switch options.(type) {
+      case *EPubOptions:
+         opt = options.(*EPubOptions)
+
+         // Checked before anything is added to the book
+         if opt.TOCItemTitle == "" && (opt.TOCTitle != "" || opt.TOC != nil || opt.Headings != nil) {
+            return "", nil, nil, ugarit.ErrorTOCItemTitleNotFound
+         }
+         if _, ok := opt.TOC.(*TOCContent); opt.TOC != nil && !ok {
+            return "", nil, nil, ugarit.ErrorInvalidOptionType
+         }
+      default:
+         return "", nil, nil, ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   if src != nil && opt != nil && opt.Headings != nil && mimetype == "application/xhtml+xml" {
+      data, err = io.ReadAll(src)
+      if err != nil {
+         return "", nil, nil, err
+      }
+      data, heads, err = ugarit.ScanHeadings(data, opt.Headings.Selector)
+      if err != nil {
+         return "", nil, nil, err
+      }
+      src = bytes.NewReader(data)
+   }
 
    pos = len(b.Package.Manifest)
 
@@ -127,73 +157,77 @@ func (b *Book) AddPage(path string, mimetype string, src io.Reader, id string, o
       return "", w, nil, err
    }
 
+   // The file was already in the manifest (e.g. replacing a loaded one)
+   existed = pos == len(b.Package.Manifest)
+   if existed {
+      for pos=0; pos<len(b.Package.Manifest) && b.Package.Manifest[pos].ID!=id; pos++ {}
+   }
+
    //   fmt.Printf("OPTIONS: %#v\n",options)
 
-   if options != nil {
-      switch options.(type) {
-      case *EPubOptions:
-         opt = options.(*EPubOptions)
-         if opt.TOCTitle != "" {
-            if opt.TOCItemTitle == "" {
-               return "", w, nil, ugarit.ErrorTOCItemTitleNotFound
-            }
-
-            tc = &TOCContent{
-               ndx:        pos,
-               Title:      opt.TOCTitle,
-               index:      make([]*TOCContent, 1, 4),
-               subSection: ugarit.NewArabicNumbering("Chapter", true),
-            }
-
-            if opt.TOC != nil {
-               switch opt.TOC.(type) {
-               case *TOCContent:
-                  opt.TOC.(*TOCContent).index = append(opt.TOC.(*TOCContent).index, tc)
-               default:
-                  return "", w, nil, ugarit.ErrorInvalidOptionType
-               }
-            } else {
-               b.index = append(b.index, tc)
-            }
-
-            tc.index = append(tc.index, &TOCContent{
-               ndx:        pos,
-               Title:      opt.TOCItemTitle,
-               index:      make([]*TOCContent, 0, 4),
-               subSection: ugarit.NewArabicNumbering("Chapter", true),
-            })
-
-//            fmt.Printf("TOC: %#v\n", b.index)
-         } else {
-            tc = &TOCContent{
-               ndx:        pos,
-               Title:      opt.TOCItemTitle,
-               index:      make([]*TOCContent, 0, 4),
-               subSection: ugarit.NewArabicNumbering("Chapter", true),
-            }
-
-            if opt.TOC != nil {
-               switch opt.TOC.(type) {
-               case *TOCContent:
-                  opt.TOC.(*TOCContent).index = append(opt.TOC.(*TOCContent).index, tc)
-               default:
-                  return "", w, nil, ugarit.ErrorInvalidOptionType
-               }
-            } else {
-               b.index = append(b.index, tc)
-            }
+   if opt != nil && opt.TOCItemTitle != "" {
+      page = &TOCContent{
+         ndx:        pos,
+         Title:      opt.TOCItemTitle,
+         index:      make([]*TOCContent, 0, 4),
+      }
+      addHeadings(page, heads, opt.Headings)
+
+      tc = page
+      if opt.TOCTitle != "" {
+         tc = &TOCContent{
+            ndx:        pos,
+            Title:      opt.TOCTitle,
+            index:      append(make([]*TOCContent, 0, 4), page),
          }
-      default:
-         return "", nil, nil, ugarit.ErrorInvalidOptionType
+      }
 
+      // A page added again takes the place of its TOC entry, keeping the
+      // sub-entries if it brings none
+      if parent, i := findTOC(b.index, pos); existed && parent != nil {
+         if len(page.index) == 0 {
+            page.index = parent[i].index
+         }
+         parent[i] = tc
+      } else if opt.TOC != nil {
+         opt.TOC.(*TOCContent).index = append(opt.TOC.(*TOCContent).index, tc)
+      } else {
+         b.index = append(b.index, tc)
       }
+//      fmt.Printf("TOC: %#v\n", b.index)
+   }
+
+   if opt != nil && opt.Landmark != "" {
+      b.setLandmark(pos, opt.Landmark, opt.LandmarkTitle)
    }
 
+   // A page added again keeps its place in the spine
+   for _, si := range b.Package.Spine.Itemref {
+      if si.IDref == id {
+         return id, w, tc, nil
+      }
+   }
    b.Package.Spine.Itemref = append(b.Package.Spine.Itemref, SpineItem{IDref: id})
 
    return id, w, tc, nil
 }
 
+// findTOC looks in the index, and in its sub-entries, for the first entry
+// pointing to the whole Nth manifest item. It returns the index holding the
+// entry and its position, or nil if there is none.
+func findTOC(index []*TOCContent, n int) ([]*TOCContent, int) {
+   for i, tc := range index {
+      if tc.ndx == n && tc.fragment == "" {
+         return index, i
+      }
+      if parent, j := findTOC(tc.index, n); parent != nil {
+         return parent, j
+      }
+   }
+
+   return nil, -1
+}
+
 // AddCover saves the Cover in the E-Book. Use it before saving any content to the E-Book
 func (b *Book) AddCover(path string, mimetype string, src io.Reader, options interface{}) (string, io.Writer, error) {
    var w io.Writer
@@ -205,6 +239,10 @@ func (b *Book) AddCover(path string, mimetype string, src io.Reader, options int
    var extension string
    var fileprop string
 
+   if b.err != nil {
+      return "", nil, b.err
+   }
+
    if options != nil {
       switch options.(type) {
       case *EPubOptions:
@@ -256,20 +294,21 @@ func (b *Book) AddCover(path string, mimetype string, src io.Reader, options int
    return id, w, nil
 }
 
-// AddTOC saves the TOC file to the E-Book. Use it just before closing the E-Book
-func (b *Book) AddTOC(gen ugarit.IndexGenerator, id string) (string, error) {
+// mkTOC Construct the Table of Contents
+func mkTOC(index []*TOCContent, gen ugarit.IndexGenerator, manif []Manifest) error {
    var err error
-   var r io.Reader
    var txt *html.Node
+   var href string
 
-   if id == "" {
-      id = gen.GetId()
-   }
+   for i, ndx := range index {
+      href = manif[ndx.ndx].Href
+      if ndx.fragment != "" {
+         href += "#" + ndx.fragment
+      }
 
-   for i, ndx := range b.index {
       txt = &html.Node{
          Type: html.TextNode,
-         Data: ndx.Title,
+         Data: ndx.label(),
       }
       err = gen.AddItem(&html.Node{
          FirstChild: txt,
@@ -280,7 +319,7 @@ func (b *Book) AddTOC(gen ugarit.IndexGenerator, id string) (string, error) {
          Attr: []html.Attribute{
             html.Attribute{
                Key: "href",
-               Val: b.Package.Manifest[ndx.ndx].Href,
+               Val: href,
             },
             html.Attribute{
                Key: "id",
@@ -288,6 +327,56 @@ func (b *Book) AddTOC(gen ugarit.IndexGenerator, id string) (string, error) {
             },
          },
       })
+      if err != nil {
+         return err
+      }
+
+      if len(ndx.index) > 0 {
+         gen.AddSection()
+         err = mkTOC(ndx.index, gen, manif)
+         gen.EndSection()
+         if err != nil {
+            return err
+         }
+      }
+   }
+
+   return nil
+}
+
+// AddTOC saves the TOC file to the E-Book. Use it just before closing the E-Book
+func (b *Book) AddTOC(gen ugarit.IndexGenerator, id string) (string, error) {
+   var err error
+   var r io.Reader
+
+   if b.err != nil {
+      return "", b.err
+   }
+
+   if id == "" {
+      id = gen.GetId()
+   }
+
+   // The TOC being generated replaces the loaded one
+   if b.src != nil {
+      b.dropLoaded(func(m Manifest) bool {
+         return m.MediaType == gen.GetMimeType()
+      })
+   }
+
+   err = ugarit.NumberSections(b.sections(b.index), b.subSection, "", b.numbered)
+   if err != nil {
+      return "", err
+   }
+
+   err = mkTOC(b.index, gen, b.Package.Manifest)
+   if err != nil {
+      return "", err
+   }
+
+   err = b.addPageList(gen)
+   if err != nil {
+      return "", err
    }
 
    r, err = gen.GetDocument()
@@ -297,6 +386,9 @@ func (b *Book) AddTOC(gen ugarit.IndexGenerator, id string) (string, error) {
    }
 
    id, _, err = b.addFile(gen.GetPathName(), gen.GetMimeType(), r, "ncx", nil, "")
+   if err == nil {
+      b.Package.Spine.Toc = id
+   }
 
    return id, err
 }
@@ -315,7 +407,10 @@ func (b *Book) TOCLen() int {
    return len(b.index)
 }
 
-// SubSectionStyle sets the object to style the top level section of the TOC
+// SubSectionStyle sets the object to style the top level section of the TOC.
+// AddTOC numbers the TOC labels with it, e.g. "Chapter 1.2 Title"; the
+// subsections without a style of their own share the style of their parent
+// section. The TOC isn't numbered if no style is set.
 func (b *Book) SubSectionStyle(sty ugarit.SectionStyle) {
    b.subSection = sty
 }
@@ -387,11 +482,51 @@ func (b *Book) AddFile(path string, mimetype string, src io.Reader, id string, o
    return b.addFile(path, mimetype, src, id, opt, optProp)
 }
 
+// AddReference registers a file as having the provided mimetype, without
+// storing its content in the E-Book.
+func (b *Book) AddReference(path string, mimetype string, id string, options interface{}) (string, error) {
+   if b.err != nil {
+      return "", b.err
+   }
+
+   if options != nil {
+      switch options.(type) {
+      case *EPubOptions:
+      default:
+         return "", ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   if id == "" {
+      id = fmt.Sprintf("pg%d", b.fid)
+      b.fid++
+   }
+
+   b.Package.Manifest = append(b.Package.Manifest, Manifest{
+      ID:        id,
+      Href:      path,
+      MediaType: mimetype,
+   })
+
+   return id, nil
+}
+
 func (b *Book) addFile(path string, mimetype string, src io.Reader, id string, opt *EPubOptions, optProp string) (string, io.Writer, error) {
+   if b.err != nil {
+      return "", nil, b.err
+   }
+
    if b.Package.Manifest == nil {
       b.Package.Manifest = []Manifest{}
    }
 
+   // New contents for a file already in the book
+   for _, m := range b.Package.Manifest {
+      if m.Href == path {
+         return b.addfile(path, src, m.ID)
+      }
+   }
+
    if id == "" {
       id = fmt.Sprintf("pg%d", b.fid)
       b.fid++
@@ -406,27 +541,26 @@ func (b *Book) addFile(path string, mimetype string, src io.Reader, id string, o
    return b.addfile(path, src, id)
 }
 
+// addfile stages the file contents, which are only stored in the archive by Close
 func (b *Book) addfile(path string, src io.Reader, id string) (string, io.Writer, error) {
+   var f *file
    var err error
-   var w io.Writer
 
-   if path[0] == '/' {
-      path = b.RootFolder + path
-   } else {
-      path = b.RootFolder + "/" + path
-   }
-
-   w, err = b.zfd.Create(path)
-   if err != nil {
-      return "", nil, err
-   }
+   f = &file{data: &bytes.Buffer{}}
 
    if src != nil {
-      io.Copy(w, src)
+      _, err = io.Copy(f.data, src)
+      if err != nil {
+         // The file is in the manifest but has no contents
+         b.err = err
+         return id, nil, err
+      }
+      b.files[path] = f
       return id, nil, nil
    }
 
-   return id, w, nil
+   b.files[path] = f
+   return id, f.data, nil
 }
 
 // Sets spine attributes
@@ -442,35 +576,252 @@ func (b *Book) SpineAttr(key, val string) {
 }
 
 // Closes and saves the E-Book
+// If an earlier call failed leaving the book inconsistent, or if saving it
+// fails, the target is discarded as Abort does and the error returned.
+// Give it an ugarit.AtomicFile for the book file to be either complete or
+// left untouched.
 func (b *Book) Close() error {
+   var err error
+
+   if b.err != nil {
+      b.discard()
+      return b.err
+   }
+
+   err = b.save(b.fd)
+   if err != nil {
+      b.err = err
+      b.discard()
+      return err
+   }
+
+   err = b.fd.Close()
+   b.fd = nil
+   if err != nil {
+      b.err = err
+      return err
+   }
+
+   b.err = ugarit.ErrorBookClosed
+   return nil
+}
+
+// Abort discards the book instead of saving it: the target is closed
+// without anything written to it (an ugarit.Aborter target, like
+// ugarit.AtomicFile, is aborted instead) and later calls fail with
+// ugarit.ErrorAborted.
+func (b *Book) Abort() error {
+   if b.err == nil {
+      b.err = ugarit.ErrorAborted
+   }
+   b.files = map[string]*file{}
+
+   return b.discard()
+}
+
+// Err returns the error which made the book fail, after which the calls
+// adding to it or saving it fail fast with this error: a file which could
+// not be read, a failed save, Close or Abort.
+func (b *Book) Err() error {
+   if b.err == ugarit.ErrorBookClosed || b.err == ugarit.ErrorAborted {
+      return nil
+   }
+   return b.err
+}
+
+// discard closes the target, aborting it if it can.
+func (b *Book) discard() error {
+   var err error
+
+   if b.fd == nil {
+      return nil
+   }
+
+   if a, ok := b.fd.(ugarit.Aborter); ok {
+      err = a.Abort()
+   } else {
+      err = b.fd.Close()
+   }
+   b.fd = nil
+
+   return err
+}
+
+// Validate saves the E-Book in memory and checks it the way epubcheck would,
+// so problems can be fixed before Close. See ugarit.Finding.
+func (b *Book) Validate() ([]ugarit.Finding, error) {
+   var buf bytes.Buffer
+   var br ugarit.BookReader
+   var err error
+
+   if b.err != nil {
+      return nil, b.err
+   }
+
+   err = b.save(&buf)
+   if err != nil {
+      return nil, err
+   }
+
+   br, err = ugarit.NewReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+   if err != nil {
+      return nil, err
+   }
+
+   return br.Validate(), nil
+}
+
+// save writes the epub archive to w.
+func (b *Book) save(w io.Writer) error {
    var enc *xml.Encoder
+   var zfd *zip.Writer
+   var f io.Writer
+   var err error
+   var refs []ugarit.EncryptedFile
+   var mtime time.Time
 
-   f, err := b.zfd.Create(b.RootFolder + "/content.opf")
+   mtime = b.buildTime
+   if mtime.IsZero() {
+      mtime = ugarit.BuildTime()
+   }
+
+   zfd = zip.NewWriter(w)
+
+   f, err = zfd.CreateHeader(&zip.FileHeader{
+      Name:     "mimetype",
+      Method:   zip.Store,
+      Modified: mtime,
+   })
+   if err != nil {
+      return err
+   }
+   _, err = f.Write([]byte("application/epub+zip"))
    if err != nil {
       return err
    }
 
-   f.Write([]byte(xml.Header))
+   f, err = createEntry(zfd, "META-INF/container.xml", mtime)
+   if err != nil {
+      return err
+   }
+   _, err = f.Write([]byte(fmt.Sprintf(rootfolder, b.RootFolder)))
+   if err != nil {
+      return err
+   }
 
-   enc = xml.NewEncoder(f)
-   err = enc.Encode(b.Package)
+   refs = b.encryption()
+   if len(refs) > 0 {
+      f, err = createEntry(zfd, "META-INF/encryption.xml", mtime)
+      if err != nil {
+         return err
+      }
+      err = ugarit.WriteEncryption(f, refs)
+      if err != nil {
+         return err
+      }
+   }
+
+   err = b.storeFiles(zfd, mtime)
    if err != nil {
       return err
    }
 
-   f, err = b.zfd.Create("META-INF/com.apple.ibooks.display-options.xml")
+   f, err = createEntry(zfd, b.RootFolder + "/content.opf", mtime)
    if err != nil {
       return err
    }
 
-   f.Write([]byte(iBooksFonts))
+   _, err = f.Write([]byte(xml.Header))
+   if err != nil {
+      return err
+   }
 
-   err = b.zfd.Close()
+   enc = xml.NewEncoder(f)
+   err = enc.Encode(b.Package.escaped())
    if err != nil {
       return err
    }
 
-   return b.fd.Close()
+   f, err = createEntry(zfd, "META-INF/com.apple.ibooks.display-options.xml", mtime)
+   if err != nil {
+      return err
+   }
+
+   _, err = f.Write([]byte(iBooksFonts))
+   if err != nil {
+      return err
+   }
+
+   return zfd.Close()
+}
+
+// escaped returns a copy of the package with the manifest and guide hrefs
+// percent-encoded, as the book keeps them decoded, like the archive entry
+// names (see ugarit.EscapeHref).
+func (pkg Package) escaped() Package {
+   pkg.Manifest = append([]Manifest(nil), pkg.Manifest...)
+   for i := range pkg.Manifest {
+      pkg.Manifest[i].Href = ugarit.EscapeHref(pkg.Manifest[i].Href)
+   }
+
+   pkg.Guide.Reference = append([]Reference(nil), pkg.Guide.Reference...)
+   for i, ref := range pkg.Guide.Reference {
+      href, frag, found := strings.Cut(ref.Href, "#")
+      pkg.Guide.Reference[i].Href = ugarit.EscapeHref(href)
+      if found {
+         pkg.Guide.Reference[i].Href += "#" + frag
+      }
+   }
+
+   return pkg
+}
+
+// storeFiles saves the staged and loaded files in the archive, in manifest
+// order, dated mtime.
+func (b *Book) storeFiles(zfd *zip.Writer, mtime time.Time) error {
+   var w io.Writer
+   var err error
+
+   for _, m := range b.Package.Manifest {
+      f, ok := b.files[m.Href]
+      if !ok {
+         continue
+      }
+
+      w, err = createEntry(zfd, b.RootFolder + "/" + strings.TrimLeft(m.Href, "/"), mtime)
+      if err != nil {
+         return err
+      }
+
+      if f.obfuscation != "" {
+         err = b.storeObfuscated(w, f)
+      } else if f.data != nil {
+         _, err = w.Write(f.data.Bytes())
+      } else {
+         err = b.copyLoaded(w, f.loaded)
+      }
+      if err != nil {
+         return err
+      }
+   }
+
+   return nil
+}
+
+// createEntry adds to the archive a compressed file dated mtime.
+func createEntry(zfd *zip.Writer, name string, mtime time.Time) (io.Writer, error) {
+   return zfd.CreateHeader(&zip.FileHeader{
+      Name:     name,
+      Method:   zip.Deflate,
+      Modified: mtime,
+   })
+}
+
+// SetBuildTime makes the archive entries dated t instead of
+// ugarit.BuildTime(). Stamping two builds of the same contents with the
+// same time makes them byte for byte identical.
+func (b *Book) SetBuildTime(t time.Time) {
+   b.buildTime = t.UTC().Truncate(time.Second)
 }
 
 func (b *Book) AddMetadata(key, val string) {
@@ -507,7 +858,6 @@ func NewIndexGenerator(lang string, uid string, tit string, auth string, b ugari
       Title:  tit,
       Author: auth,
       Points: []NavPoint{},
-      //      Pages:     []PageTarget{},
    }
 
    ig.curr = []*[]NavPoint{&ig.doc.Points}
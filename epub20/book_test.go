@@ -0,0 +1,149 @@
+package epub20_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestAddPageAgain(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a", "b", "a"} {
+		if _, _, _, err = b.AddPage(p+".xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{TOCItemTitle: strings.ToUpper(p)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, _, err = b.AddPage("a.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{TOCItemTitle: "A2"}); err != nil {
+		t.Fatal(err)
+	}
+	gen, _ := epub20.NewIndexGenerator("en", "id", "T", "A", b)
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range br.Spine() {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("spine: got %d itemrefs, want 2", n)
+	}
+	toc := br.TOC().Children
+	if len(toc) != 2 || toc[0].Title != "A2" || toc[1].Title != "B" {
+		t.Errorf("TOC: got %v", toc)
+	}
+}
+
+func TestAddPageLandmarkOnly(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("a.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{TOCItemTitle: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	// A landmark alone does not make a TOC entry
+	if _, _, _, err = b.AddPage("b.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{Landmark: "bodymatter"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("c.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{TOCTitle: "Part"}); err != ugarit.ErrorTOCItemTitleNotFound {
+		t.Errorf("TOCTitle alone: got %v", err)
+	}
+	gen, _ := epub20.NewIndexGenerator("en", "id", "T", "A", b)
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ncx := testutil.ZipEntry(t, buf.Bytes(), ".ncx"); bytes.Count(ncx, []byte("<navPoint")) != 1 {
+		t.Errorf("ncx: got %s", ncx)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	codes := func(findings []ugarit.Finding) map[string]int {
+		res := map[string]int{}
+		for _, f := range findings {
+			if f.Severity >= ugarit.SeverityError {
+				res[f.Code]++
+			}
+		}
+		return res
+	}
+
+	b, err := epub20.New(&testutil.BufCloser{}, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("ch1.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if findings, err := b.Validate(); err != nil || len(codes(findings)) != 0 {
+		t.Errorf("Validate: got %v, %v", findings, err)
+	}
+}
+
+func TestReproducibleBuild(t *testing.T) {
+	stamp := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+
+	build := func() []byte {
+		var buf testutil.BufCloser
+
+		b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.SetBuildTime(stamp)
+		if _, _, _, err = b.AddPage("text/ch1.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", nil); err != nil {
+			t.Fatal(err)
+		}
+		if err = b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	first := build()
+	time.Sleep(1100 * time.Millisecond)
+	if !bytes.Equal(first, build()) {
+		t.Errorf("builds with the same time differ")
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	// Write errors are reported by Close
+	b, err := epub20.New(testutil.FailWriter{}, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err == nil {
+		t.Errorf("Close: no write error")
+	}
+	if err = b.Rename("ch1.xhtml", "ch2.xhtml"); err == nil {
+		t.Errorf("Rename after failure: no error")
+	}
+	if _, err = b.AddCollection(ugarit.Collection{Name: "S"}); err == nil {
+		t.Errorf("AddCollection after failure: no error")
+	}
+}
@@ -0,0 +1,39 @@
+package epub20
+
+import (
+   "github.com/luisfurquim/ugarit"
+)
+
+// AddCollection declares the series the book belongs to, as the
+// calibre:series and calibre:series_index metas most EPUB 2 reading systems
+// understand. These hold a single series, so a new call replaces the
+// previous one; sets are declared as series too.
+// It returns "", as the calibre metas have no id, keeping the signature of
+// the EPUB 3 AddCollection.
+func (b *Book) AddCollection(c ugarit.Collection) (string, error) {
+   var err error
+   var metas []Metatag
+
+   if b.err != nil {
+      return "", b.err
+   }
+
+   err = c.Check()
+   if err != nil {
+      return "", err
+   }
+
+   for _, m := range b.Package.Metadata.Metatag {
+      if m.Name != "calibre:series" && m.Name != "calibre:series_index" {
+         metas = append(metas, m)
+      }
+   }
+   b.Package.Metadata.Metatag = metas
+
+   b.AddMetadata("calibre:series", c.Name)
+   if c.Position != "" {
+      b.AddMetadata("calibre:series_index", c.Position)
+   }
+
+   return "", nil
+}
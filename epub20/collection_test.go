@@ -0,0 +1,34 @@
+package epub20_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestCollections(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []ugarit.Collection{{Name: "Old", Position: "1"}, {Name: "The Trilogy", Position: "2.5"}} {
+		if _, err = b.AddCollection(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := br.Metadata().Collections; len(got) != 1 || got[0] != (ugarit.Collection{Name: "The Trilogy", Type: "series", Position: "2.5"}) {
+		t.Errorf("collections: got %+v", got)
+	}
+}
@@ -1,9 +1,11 @@
 package epub20
 
 import (
-   "archive/zip"
+   "bytes"
+   "encoding/xml"
    "github.com/luisfurquim/ugarit"
    "io"
+   "time"
 )
 
 type EPubOptions struct {
@@ -11,6 +13,9 @@ type EPubOptions struct {
    TOCTitle     string
    TOC          ugarit.TOCRef
    TOCItemTitle string
+   Headings     *ugarit.HeadingOptions // AddPage: nests TOC entries of the page headings under the page entry
+   Landmark     string // AddPage: semantic role of the page (titlepage, bodymatter, index...), see ugarit.LandmarkRole
+   LandmarkTitle string // AddPage: title of the guide reference; ugarit.LandmarkLabel of the role if empty
 }
 
 type IndexOptions struct {
@@ -26,6 +31,8 @@ type TOCContent struct {
    index      []*TOCContent
    ref        string
    subSection ugarit.SectionStyle
+   fragment   string // appended to the page href, for entries pointing inside a page
+   number     string // section number set by AddTOC, prepended to the label
 }
 
 //Ncx OPS/toc.ncx
@@ -38,7 +45,12 @@ type Ncx struct {
    Title    string       `xml:"docTitle>text,omitempty"`
    Author   string       `xml:"docAuthor>text,omitempty"`
    Points   []NavPoint   `xml:"navMap>navPoint"`
-   Pages    []PageTarget `xml:"pageList,omitempty"`
+   PageList *PageList    `xml:"pageList,omitempty"`
+}
+
+//PageList NCX page list, left out when the book has no page breaks
+type PageList struct {
+   Targets []PageTarget `xml:"pageTarget"`
 }
 
 //NavPoint nav point
@@ -56,24 +68,45 @@ type Content struct {
 }
 
 type PageTarget struct {
-   XMLName struct{} `xml:"pageTarget"`
-   Id      string   `xml:"id,attr"`
-   Type    string   `xml:"type,attr"`
-   Value   string   `xml:"value,attr"`
-   Label   string   `xml:"navLabel>text"`
-   Content Content  `xml:"content"`
+   XMLName   struct{} `xml:"pageTarget"`
+   Id        string   `xml:"id,attr"`
+   Type      string   `xml:"type,attr"`
+   Value     string   `xml:"value,attr,omitempty"`
+   PlayOrder string   `xml:"playOrder,attr"`
+   Label     string   `xml:"navLabel>text"`
+   Content   Content  `xml:"content"`
 }
 
 // Book epub book
 type Book struct {
    Package    Package `xml:"package"`
    cwd        string
-   zfd        *zip.Writer
    fd         io.WriteCloser
    fid        int
    index      []*TOCContent
    subSection ugarit.SectionStyle
+   numbered   bool // set by NumberHeadings; AddTOC writes the section numbers into the page headings
    RootFolder string
+   src        ugarit.BookReader // set by Open; source of the loaded files
+   files      map[string]*file  // book files kept until Close, by href
+   pages      []pageBreak       // set by AddPageBreak; AddTOC lists them in the NCX page list
+   buildTime  time.Time         // set by SetBuildTime; ugarit.BuildTime() if zero
+   err        error             // sticky error, see Err; set by Close and Abort too
+}
+
+// pageBreak is a print page break registered by AddPageBreak.
+type pageBreak struct {
+   label string
+   href  string // manifest href of the file the page starts in
+   id    string // fragment id of the page start, if any
+}
+
+// file is the content of a book file, either staged in memory or still in
+// the book Open loaded it from.
+type file struct {
+   data   *bytes.Buffer
+   loaded string // path in the source book, if data is nil
+   obfuscation string // font obfuscation algorithm applied when saved, see AddFont
 }
 
 //Package content.opf
@@ -81,6 +114,7 @@ type Package struct {
    XMLName  struct{}   `xml:"package"`
    Version  string     `xml:"version,attr"`
    Xmlns    string     `xml:"xmlns,attr"`
+   XmlnsOpf string     `xml:"xmlns:opf,attr,omitempty"`
    UID      string     `xml:"unique-identifier,attr"`
    Metadata Metadata   `xml:"metadata"`
    Manifest []Manifest `xml:"manifest>item"`
@@ -98,18 +132,33 @@ type Metadata struct {
    Publisher  []string     `xml:"dc:publisher"`
    Date       []Date       `xml:"dc:date"`
    Signature  *Signature   `xml:"link,omitempty"`
+   DC         []DCElement
    Metatag    []Metatag    `xml:"meta"`
 }
 
+// DCElement is any Dublin Core element without a dedicated Metadata field
+// (dc:subject, dc:contributor...), or one needing attributes the dedicated
+// field can't hold. XMLName holds the prefixed name, e.g. "dc:subject".
+type DCElement struct {
+   XMLName  xml.Name
+   ID       string `xml:"id,attr,omitempty"`
+   Langattr string `xml:"xml:lang,attr,omitempty"`
+   Role     string `xml:"opf:role,attr,omitempty"`
+   FileAs   string `xml:"opf:file-as,attr,omitempty"`
+   Event    string `xml:"opf:event,attr,omitempty"`
+   Data     string `xml:",chardata"`
+}
+
 // Identifier
 type Identifier struct {
    Data   string `xml:",chardata"`
    ID     string `xml:"id,attr,omitempty"`
-   Scheme string `xml:"scheme,attr,omitempty"`
+   Scheme string `xml:"opf:scheme,attr,omitempty"`
 }
 
 // Author
 type Author struct {
+   ID     string `xml:"id,attr,omitempty"`
    Role   string `xml:"role,attr,omitempty"`
    FileAs string `xml:"file-as,attr,omitempty"`
    Data   string `xml:",chardata"`
@@ -0,0 +1,109 @@
+package epub20
+
+import (
+   "io"
+   "bytes"
+   "strings"
+   "github.com/luisfurquim/ugarit"
+)
+
+// AddFont stores the font in the E-Book, as AddFile does, with the media
+// type its extension (.otf, .ttf, .woff or .woff2) tells.
+// Options, if not nil, must be a *ugarit.FontOptions. If it has an
+// Obfuscation algorithm, the font is obfuscated when the book is saved,
+// keyed on the book identifiers as they are then, and listed in
+// META-INF/encryption.xml. The staged font, as Open returns it, is kept
+// as it is.
+func (b *Book) AddFont(path string, src io.Reader, id string, options interface{}) (string, io.Writer, error) {
+   var opt *ugarit.FontOptions
+   var mimetype string
+   var w io.Writer
+   var n int
+   var err error
+
+   if b.err != nil {
+      return "", nil, b.err
+   }
+
+   opt = &ugarit.FontOptions{}
+   if options != nil {
+      switch options.(type) {
+      case *ugarit.FontOptions:
+         opt = options.(*ugarit.FontOptions)
+      default:
+         return "", nil, ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   err = opt.Check()
+   if err != nil {
+      return "", nil, err
+   }
+
+   mimetype, err = ugarit.FontMediaType(path, true)
+   if err != nil {
+      return "", nil, err
+   }
+
+   id, w, err = b.AddFile(path, mimetype, src, id, nil)
+   if err != nil {
+      return "", nil, err
+   }
+
+   n = b.lookup(path)
+   if n < 0 {
+      return "", nil, ugarit.ErrorFileNotFound
+   }
+   b.files[b.Package.Manifest[n].Href].obfuscation = opt.Obfuscation
+
+   return id, w, nil
+}
+
+// encryption lists the obfuscated fonts, for META-INF/encryption.xml.
+func (b *Book) encryption() []ugarit.EncryptedFile {
+   var refs []ugarit.EncryptedFile
+
+   for _, m := range b.Package.Manifest {
+      if f, ok := b.files[m.Href]; ok && f.obfuscation != "" {
+         refs = append(refs, ugarit.EncryptedFile{
+            URI:       b.RootFolder + "/" + strings.TrimLeft(m.Href, "/"),
+            Algorithm: f.obfuscation,
+         })
+      }
+   }
+
+   return refs
+}
+
+// storeObfuscated writes the font to w, obfuscated.
+func (b *Book) storeObfuscated(w io.Writer, f *file) error {
+   var buf bytes.Buffer
+   var uid string
+   var ids []string
+   var data []byte
+   var err error
+
+   if f.data != nil {
+      buf.Write(f.data.Bytes())
+   } else {
+      err = b.copyLoaded(&buf, f.loaded)
+      if err != nil {
+         return err
+      }
+   }
+
+   for _, id := range b.Package.Metadata.Identifier {
+      ids = append(ids, id.Data)
+      if uid == "" && id.ID == b.Package.UID {
+         uid = id.Data
+      }
+   }
+
+   data, err = ugarit.ObfuscateFont(buf.Bytes(), f.obfuscation, uid, ids)
+   if err != nil {
+      return err
+   }
+
+   _, err = w.Write(data)
+   return err
+}
@@ -0,0 +1,49 @@
+package epub20_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestFonts(t *testing.T) {
+	var buf testutil.BufCloser
+
+	font := make([]byte, 2000)
+	for i := range font {
+		font[i] = byte(i * 7)
+	}
+	uid := "urn:isbn:9780306406157"
+	key := sha1.Sum([]byte(uid))
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{uid}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = b.AddFont("a.otf", bytes.NewReader(font), "", &ugarit.FontOptions{Obfuscation: ugarit.ObfuscationIDPF}); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stored := testutil.ZipEntry(t, buf.Bytes(), "a.otf"); stored[0] != font[0]^key[0] {
+		t.Errorf("a.otf not obfuscated")
+	}
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm, _ := br.ItemByPath("a.otf")
+	r, err := br.DocReader("a.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(r); dm.MimeType != "application/vnd.ms-opentype" || !bytes.Equal(data, font) {
+		t.Errorf("a.otf: %s, not de-obfuscated", dm.MimeType)
+	}
+}
@@ -0,0 +1,49 @@
+package epub20_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestTOCHeadings(t *testing.T) {
+	var buf testutil.BufCloser
+
+	page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title></head><body>
+<h1>Chapter</h1>
+<h2>First <em>part</em></h2><p>a</p>
+<h3 id="heading1">Detail</h3>
+<h4>Too deep</h4>
+<h2 class="x">Second</h2>
+<h2></h2>
+<p class="sec" aria-level="2">Aside</p>
+</body></html>`
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("ch.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub20.EPubOptions{TOCItemTitle: "Chapter", Headings: &ugarit.HeadingOptions{Selector: "h1, .sec"}}); err != nil {
+		t.Fatal(err)
+	}
+	gen, err := epub20.NewIndexGenerator("en", "id", "T", "", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := b.Open("toc.ncx")
+	data, _ := io.ReadAll(r)
+	if !strings.Contains(string(data), `<text>Aside</text></navLabel><content src="ch.xhtml#heading3">`) {
+		t.Errorf("ncx: got %s", data)
+	}
+	if strings.Count(string(data), "<navPoint") != 2 {
+		t.Errorf("ncx: lone h1 not left out: %s", data)
+	}
+}
@@ -0,0 +1,101 @@
+package epub20
+
+import (
+   "strings"
+   "github.com/luisfurquim/ugarit"
+)
+
+// AddIdentifier adds an identifier to the book metadata, with its scheme as
+// the opf:scheme attribute. Options, if not nil, must be a
+// *ugarit.IdentifierOptions. ISBNs are checked and written as their bare
+// digits, as EPUB 2 reading systems expect them; UUIDs are checked and
+// written in their urn:uuid: form (see ugarit.NormalizeIdentifier).
+// It returns the identifier id; an id given in the options must not be in
+// use yet (ugarit.ErrorDuplicateID).
+func (b *Book) AddIdentifier(value string, options interface{}) (string, error) {
+   var opt *ugarit.IdentifierOptions
+   var scheme string
+   var err error
+
+   if b.err != nil {
+      return "", b.err
+   }
+
+   opt = &ugarit.IdentifierOptions{}
+   if options != nil {
+      switch options.(type) {
+      case *ugarit.IdentifierOptions:
+         opt = options.(*ugarit.IdentifierOptions)
+      default:
+         return "", ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   value, scheme, err = ugarit.NormalizeIdentifier(value, opt.Scheme)
+   if err != nil {
+      return "", err
+   }
+   if strings.ToUpper(scheme) == "ISBN" {
+      value = strings.TrimPrefix(value, "urn:isbn:")
+   }
+
+   id := opt.ID
+   if id == "" {
+      id = ugarit.NewID("pub-id", b.usedIDs())
+   } else if b.usedIDs()[id] {
+      return "", ugarit.ErrorDuplicateID
+   }
+
+   b.Package.Metadata.Identifier = append(b.Package.Metadata.Identifier, Identifier{
+      Data:   value,
+      ID:     id,
+      Scheme: scheme,
+   })
+
+   if opt.Unique {
+      b.Package.UID = id
+   }
+
+   return id, nil
+}
+
+// SetUniqueIdentifier makes the identifier with the given id the
+// unique-identifier of the package, the one font obfuscation keys on.
+func (b *Book) SetUniqueIdentifier(id string) error {
+   if b.err != nil {
+      return b.err
+   }
+
+   for _, ident := range b.Package.Metadata.Identifier {
+      if ident.ID == id {
+         b.Package.UID = id
+         return nil
+      }
+   }
+
+   return ugarit.ErrorUnknownIdentifier
+}
+
+// usedIDs collects the ids of the metadata and manifest items.
+func (b *Book) usedIDs() map[string]bool {
+   var used map[string]bool
+   var md *Metadata
+
+   md = &b.Package.Metadata
+   used = map[string]bool{}
+   for _, ident := range md.Identifier {
+      used[ident.ID] = true
+   }
+   for _, c := range md.Creator {
+      used[c.ID] = true
+   }
+   for _, el := range md.DC {
+      used[el.ID] = true
+   }
+   for _, m := range b.Package.Manifest {
+      used[m.ID] = true
+   }
+   delete(used, "")
+
+   return used
+}
@@ -0,0 +1,44 @@
+package epub20_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestIdentifiers(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"a", "b"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	isbn, err := b.AddIdentifier("urn:isbn:0-306-40615-2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.AddIdentifier("urn:isbn:0-306-40615-2", &ugarit.IdentifierOptions{ID: "pub-id"}); err != ugarit.ErrorDuplicateID {
+		t.Errorf("duplicate id: got %v", err)
+	}
+	if err = b.SetUniqueIdentifier(isbn); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	opf := string(testutil.ZipEntry(t, buf.Bytes(), "content.opf"))
+	if want := `<dc:identifier id="pub-id2" opf:scheme="ISBN">0306406152</dc:identifier>`; !strings.Contains(opf, want) || !strings.Contains(opf, `unique-identifier="pub-id2"`) {
+		t.Errorf("content.opf: %s missing in %s", want, opf)
+	}
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := br.Metadata().Identifier(); id.Value != "0306406152" || id.Scheme != "ISBN" {
+		t.Errorf("unique identifier: got %+v", id)
+	}
+}
@@ -0,0 +1,25 @@
+package epub20
+
+import (
+   "github.com/luisfurquim/ugarit"
+)
+
+// setLandmark gives the Nth manifest item a semantic role (see
+// ugarit.LandmarkRole), as a guide reference of the matching type.
+func (b *Book) setLandmark(n int, role, label string) {
+   var href string
+   var guide []Reference
+
+   href = b.Package.Manifest[n].Href
+   if label == "" {
+      label = ugarit.LandmarkLabel(role)
+   }
+
+   role = ugarit.GuideType(role)
+   for _, r := range b.Package.Guide.Reference {
+      if r.Href != href || r.Type != role {
+         guide = append(guide, r)
+      }
+   }
+   b.Package.Guide.Reference = append(guide, Reference{Href: href, Type: role, Title: label})
+}
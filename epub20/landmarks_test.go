@@ -0,0 +1,46 @@
+package epub20_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestLandmarks(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("ch.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{TOCItemTitle: "One", Landmark: "bodymatter"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("app.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{TOCItemTitle: "A", Landmark: "appendix", LandmarkTitle: "Appendix A"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var guide []string
+	for _, ref := range br.Guide() {
+		guide = append(guide, ref.Type+"="+ref.Href+"="+ref.Title)
+	}
+	if got, want := strings.Join(guide, " "), "text=ch.xhtml=Start other.appendix=app.xhtml=Appendix A"; got != want {
+		t.Errorf("guide: got %q, want %q", got, want)
+	}
+	r, _ := br.DocReader("ch.xhtml")
+	data, _ := io.ReadAll(r)
+	if string(data) != testutil.Chapter {
+		t.Errorf("page changed: %s", data)
+	}
+}
@@ -0,0 +1,84 @@
+package epub20
+
+import (
+   "io"
+   "bytes"
+   "github.com/luisfurquim/ugarit"
+)
+
+// NumberHeadings tells AddTOC whether to also write the section numbers
+// into the page headings (see ugarit.NumberHeading), besides the TOC labels.
+func (b *Book) NumberHeadings(on bool) {
+   b.numbered = on
+}
+
+// label returns the TOC label of the entry, preceded by its section number.
+func (tc *TOCContent) label() string {
+   if tc.number == "" {
+      return tc.Title
+   }
+   return tc.number + " " + tc.Title
+}
+
+// section lets ugarit.NumberSections number a TOC entry of the book.
+type section struct {
+   b  *Book
+   tc *TOCContent
+}
+
+// sections wraps the entries of the TOC section for ugarit.NumberSections.
+func (b *Book) sections(index []*TOCContent) []ugarit.Section {
+   var s []ugarit.Section
+   var tc *TOCContent
+
+   for _, tc = range index {
+      s = append(s, section{b: b, tc: tc})
+   }
+
+   return s
+}
+
+func (s section) Subsections() []ugarit.Section {
+   return s.b.sections(s.tc.index)
+}
+
+func (s section) SubsectionStyle() ugarit.SectionStyle {
+   return s.tc.subSection
+}
+
+func (s section) SetNumber(number string) {
+   s.tc.number = number
+}
+
+func (s section) Page() ([]byte, string, error) {
+   var m Manifest
+   var r io.Reader
+   var page []byte
+   var err error
+
+   m = s.b.Package.Manifest[s.tc.ndx]
+   if m.MediaType != "application/xhtml+xml" {
+      return nil, "", nil
+   }
+
+   // Files registered by AddReference have no contents
+   r, err = s.b.Open(m.Href)
+   if err != nil {
+      return nil, "", nil
+   }
+   page, err = io.ReadAll(r)
+   if err != nil {
+      return nil, "", err
+   }
+
+   return page, s.tc.fragment, nil
+}
+
+func (s section) SetPage(page []byte) error {
+   var m Manifest
+   var err error
+
+   m = s.b.Package.Manifest[s.tc.ndx]
+   _, _, err = s.b.addfile(m.Href, bytes.NewReader(page), m.ID)
+   return err
+}
@@ -0,0 +1,49 @@
+package epub20_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestTOCNumbering(t *testing.T) {
+	page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title></head><body><p>intro</p><h2>Title</h2><section id="s1"><h3>Sub</h3></section></body></html>`
+
+	b, err := epub20.New(&testutil.BufCloser{}, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SubSectionStyle(ugarit.NewUpperRomanNumbering("Part", false))
+	_, _, part, err := b.AddPage("p1.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub20.EPubOptions{TOCItemTitle: "First"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.SubSectionStyle(ugarit.NewArabicNumbering("", true))
+	if _, _, _, err = b.AddPage("p2.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub20.EPubOptions{TOCItemTitle: "Second", TOC: part}); err != nil {
+		t.Fatal(err)
+	}
+	gen, err := epub20.NewIndexGenerator("en", "id", "T", "", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := b.Open("toc.ncx")
+	data, _ := io.ReadAll(r)
+	for _, want := range []string{"<text>Part I First</text>", "<text>I.1 Second</text>"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ncx: %s missing in %s", want, data)
+		}
+	}
+	r, _ = b.Open("p2.xhtml")
+	data, _ = io.ReadAll(r)
+	if strings.Contains(string(data), "section-number") {
+		t.Errorf("epub20 headings numbered without NumberHeadings: %s", data)
+	}
+}
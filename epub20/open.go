@@ -0,0 +1,272 @@
+package epub20
+
+import (
+   "io"
+   "fmt"
+   "encoding/xml"
+   "github.com/luisfurquim/ugarit"
+)
+
+// Open loads the book read by src into a new Book which will be saved to target.
+// Manifest, spine, metadata, guide and TOC are kept, so pages, files and
+// metadata may be added on top of them before Close writes the new archive.
+// Calling AddFile with the path of a loaded file replaces its contents.
+// Calling AddTOC replaces the loaded NCX, keeping the loaded TOC entries.
+// EPub 3 only features (manifest and spine properties, refines metadata)
+// are dropped, except for role, file-as and identifier-type refinements,
+// which become opf attributes.
+// The loaded files are copied from src when the book is closed, so src must
+// not be closed before that.
+func Open(src ugarit.BookReader, target io.WriteCloser) (*Book, error) {
+   var b *Book
+   var err error
+   var byId map[string]int
+
+   b, err = New(target, nil, nil, nil, nil, nil, nil, Signature{}, nil, src.PageProgression())
+   if err != nil {
+      return nil, err
+   }
+
+   b.src = src
+
+   b.loadMetadata(src.Metadata())
+
+   byId = map[string]int{}
+   for _, dm := range src.Docs() {
+      // The book keeps the decoded hrefs, which name the archive entries
+      name := ugarit.UnescapeHref(dm.Path)
+      byId[dm.ID] = len(b.Package.Manifest)
+      b.Package.Manifest = append(b.Package.Manifest, Manifest{
+         ID:           dm.ID,
+         Href:         name,
+         MediaType:    dm.MimeType,
+         MediaOverlay: dm.MediaOverlay,
+      })
+      b.files[name] = &file{loaded: dm.Path, obfuscation: dm.Obfuscation}
+
+      if dm.MimeType == "application/x-dtbncx+xml" && b.Package.Spine.Toc == "" {
+         b.Package.Spine.Toc = dm.ID
+      }
+
+      // Generated ids must not collide with the loaded ones
+      var n int
+      if _, err = fmt.Sscanf(dm.ID, "pg%d", &n); err == nil && n >= b.fid {
+         b.fid = n + 1
+      }
+   }
+
+   for _, it := range src.Spine() {
+      si := SpineItem{
+         IDref: it.Doc.ID,
+         ID:    it.ID,
+      }
+      if !it.Linear {
+         si.Linear = "no"
+      }
+      b.Package.Spine.Itemref = append(b.Package.Spine.Itemref, si)
+   }
+
+   for _, ref := range src.Guide() {
+      b.Package.Guide.Reference = append(b.Package.Guide.Reference, Reference{
+         Href:  ugarit.UnescapeHref(ref.Href),
+         Type:  ref.Type,
+         Title: ref.Title,
+      })
+   }
+
+   b.index = loadTOC(src.TOC(), byId)
+
+   return b, nil
+}
+
+// loadMetadata copies the source metadata into the package.
+func (b *Book) loadMetadata(md ugarit.Metadata) {
+   var meta *Metadata
+
+   meta = &b.Package.Metadata
+
+   // attr returns the EPub 2 attribute, falling back to the EPub 3 refinement
+   attr := func(val string, mv ugarit.MetaValue, property string) string {
+      if val == "" {
+         return mv.Refinement(property)
+      }
+      return val
+   }
+
+   dc := func(name string, mv ugarit.MetaValue) {
+      meta.DC = append(meta.DC, DCElement{
+         XMLName:  xml.Name{Local: "dc:" + name},
+         ID:       mv.ID,
+         Langattr: mv.Lang,
+         Data:     mv.Value,
+      })
+   }
+
+   // Plain values fit the string slices, the others go to DC
+   plain := func(name string, values []ugarit.MetaValue, dst *[]string) {
+      for _, mv := range values {
+         if mv.ID == "" && mv.Lang == "" {
+            *dst = append(*dst, mv.Value)
+         } else {
+            dc(name, mv)
+         }
+      }
+   }
+
+   // EPub 2 has no title-type, readers take the first title as the main one
+   titles := make([]ugarit.MetaValue, 0, len(md.Titles))
+   for _, mv := range md.Titles {
+      if mv.Refinement("title-type") == "main" {
+         titles = append([]ugarit.MetaValue{mv}, titles...)
+      } else {
+         titles = append(titles, mv)
+      }
+   }
+
+   plain("title", titles, &meta.Title)
+   plain("language", md.Languages, &meta.Language)
+   plain("publisher", md.Publishers, &meta.Publisher)
+
+   // The package must name one of the identifiers as the unique one
+   b.Package.UID = ""
+   for _, ident := range md.Identifiers {
+      if ident.ID != "" && ident.ID == md.UniqueIdentifier {
+         b.Package.UID = ident.ID
+      }
+   }
+
+   for _, ident := range md.Identifiers {
+      if b.Package.UID == "" {
+         if ident.ID == "" {
+            ident.ID = "pub-id"
+         }
+         b.Package.UID = ident.ID
+      }
+      meta.Identifier = append(meta.Identifier, Identifier{
+         Data:   ident.Value,
+         ID:     ident.ID,
+         Scheme: attr(ident.Scheme, ident.MetaValue, "identifier-type"),
+      })
+   }
+
+   for _, p := range md.Creators {
+      meta.Creator = append(meta.Creator, Author{
+         ID:     p.ID,
+         Role:   attr(p.Role, p.MetaValue, "role"),
+         FileAs: attr(p.FileAs, p.MetaValue, "file-as"),
+         Data:   p.Value,
+      })
+   }
+
+   for _, p := range md.Contributors {
+      meta.DC = append(meta.DC, DCElement{
+         XMLName:  xml.Name{Local: "dc:contributor"},
+         ID:       p.ID,
+         Langattr: p.Lang,
+         Role:     attr(p.Role, p.MetaValue, "role"),
+         FileAs:   attr(p.FileAs, p.MetaValue, "file-as"),
+         Data:     p.Value,
+      })
+   }
+
+   for _, d := range md.Dates {
+      if d.ID == "" {
+         meta.Date = append(meta.Date, Date{Event: d.Event, Data: d.Value})
+      } else {
+         meta.DC = append(meta.DC, DCElement{
+            XMLName: xml.Name{Local: "dc:date"},
+            ID:      d.ID,
+            Event:   d.Event,
+            Data:    d.Value,
+         })
+      }
+   }
+
+   for _, el := range []struct {
+      name   string
+      values []ugarit.MetaValue
+   }{
+      {"subject", md.Subjects},
+      {"description", md.Descriptions},
+      {"rights", md.Rights},
+      {"source", md.Sources},
+      {"relation", md.Relations},
+      {"coverage", md.Coverages},
+      {"type", md.Types},
+      {"format", md.Formats},
+   } {
+      for _, mv := range el.values {
+         dc(el.name, mv)
+      }
+   }
+
+   // Only the EPub 2 name/content pairs are valid here
+   for _, m := range md.Meta {
+      if m.Name == "" {
+         continue
+      }
+      meta.Metatag = append(meta.Metatag, Metatag{
+         Name:     m.Name,
+         Langattr: m.Lang,
+         Content:  m.Content,
+      })
+   }
+}
+
+// loadTOC converts the TOC entries read from the source book. Entries not
+// pointing to a manifest item (headings without links, external links) are
+// skipped, their children taking their place.
+func loadTOC(parent *ugarit.TOCNode, byId map[string]int) []*TOCContent {
+   var toc []*TOCContent
+
+   toc = make([]*TOCContent, 0, parent.TOCLen())
+   for _, n := range parent.Children {
+      pos, ok := -1, false
+      if n.Doc != nil {
+         pos, ok = byId[n.Doc.ID]
+      }
+      if !ok {
+         toc = append(toc, loadTOC(n, byId)...)
+         continue
+      }
+
+      toc = append(toc, &TOCContent{
+         ndx:        pos,
+         Title:      n.Title,
+         index:      loadTOC(n, byId),
+         fragment:   n.Fragment(),
+      })
+   }
+
+   return toc
+}
+
+// dropLoaded removes the loaded files matching the filter from the book.
+func (b *Book) dropLoaded(match func(Manifest) bool) {
+   for i := 0; i < len(b.Package.Manifest); {
+      m := b.Package.Manifest[i]
+      if f, ok := b.files[m.Href]; !ok || f.loaded == "" || !match(m) {
+         i++
+         continue
+      }
+      b.removeItem(i)
+   }
+}
+
+// copyLoaded copies to w the contents of the file at path in the source book.
+func (b *Book) copyLoaded(w io.Writer, path string) error {
+   var r io.Reader
+   var err error
+
+   r, err = b.src.DocReader(path)
+   if err != nil {
+      return err
+   }
+
+   _, err = io.Copy(w, r)
+   if rc, ok := r.(io.Closer); ok {
+      rc.Close()
+   }
+
+   return err
+}
@@ -0,0 +1,119 @@
+package epub20_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestOpenForEditing(t *testing.T) {
+	var buf testutil.BufCloser
+	var paths []string
+	var err error
+
+	opt := &epub20.EPubOptions{TOCItemTitle: "Chapter 2"}
+	b, err := epub20.Open(testutil.Book(t), &buf)
+	if err != nil {
+		t.Fatalf("epub20.Open: %s", err)
+	}
+	if _, _, _, err = b.AddPage("text/ch2.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", opt); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = b.AddFile("img/cover.png", "image/png", strings.NewReader("NEWPNG"), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	gen, _ := epub20.NewIndexGenerator("en", "uid", "T", "A", b)
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+
+	md := br.Metadata()
+	if md.Title() != "The Title" || md.Identifier().Value != "urn:uuid:1b4e28ba-2fa1-11d2-883f-0016d3cca427" {
+		t.Errorf("title/identifier: got %q %q", md.Title(), md.Identifier().Value)
+	}
+	if len(md.Creators) != 1 || md.Creators[0].Role != "aut" || md.Creators[0].FileAs != "Doe, Jane" {
+		t.Errorf("creator: got %+v", md.Creators)
+	}
+	if len(md.Contributors) != 1 || md.Contributors[0].Role != "ill" || len(md.Subjects) != 1 {
+		t.Errorf("contributor/subject: got %+v %+v", md.Contributors, md.Subjects)
+	}
+
+	for _, it := range br.Spine() {
+		paths = append(paths, it.Doc.Path)
+	}
+	if len(paths) < 2 || paths[len(paths)-1] != "text/ch2.xhtml" || !strings.Contains(strings.Join(paths, " "), "text/ch1.xhtml") {
+		t.Errorf("spine: got %v", paths)
+	}
+
+	toc := br.TOC()
+	if len(toc.Children) != 2 || toc.Children[0].Title != "Chapter 1" || toc.Children[1].Title != "Chapter 2" {
+		t.Fatalf("TOC: got %+v", toc.Children)
+	}
+	if ch := toc.Children[0].Children; len(ch) != 1 || ch[0].Href != "text/ch1.xhtml#s1" {
+		t.Errorf("TOC children: got %+v", ch)
+	}
+
+	for path, want := range map[string]string{"text/ch1.xhtml": testutil.Chapter, "img/cover.png": "NEWPNG"} {
+		r, err := br.DocReader(path)
+		if err != nil {
+			t.Errorf("DocReader(%s): %s", path, err)
+			continue
+		}
+		data, _ := io.ReadAll(r)
+		if string(data) != want {
+			t.Errorf("%s: got %q", path, data)
+		}
+	}
+}
+
+func TestOpenEncodedHref(t *testing.T) {
+	var buf, buf2 testutil.BufCloser
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("my page.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{TOCItemTitle: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := epub20.Open(br, &buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The loaded file is known by its decoded path
+	patched := strings.Replace(testutil.Chapter, "Chapter 1", "Patched", 1)
+	if _, _, err = b2.AddFile("my page.xhtml", "application/xhtml+xml", strings.NewReader(patched), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = b2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if opf := string(testutil.ZipEntry(t, buf2.Bytes(), "content.opf")); !strings.Contains(opf, `href="my%20page.xhtml"`) || strings.Count(opf, "<item ") != 1 {
+		t.Errorf("content.opf: got %s", opf)
+	}
+	if !strings.Contains(string(testutil.ZipEntry(t, buf2.Bytes(), "/my page.xhtml")), "Patched") {
+		t.Errorf("my page.xhtml not patched")
+	}
+}
@@ -0,0 +1,184 @@
+package epub20
+
+import (
+   "io"
+   "fmt"
+   "bytes"
+   "regexp"
+   "strconv"
+   "encoding/xml"
+   "golang.org/x/net/html"
+   "golang.org/x/net/html/atom"
+   "github.com/luisfurquim/ugarit"
+)
+
+var romanNumeral = regexp.MustCompile(`^[ivxlcdmIVXLCDM]+$`)
+
+// AddPageBreak registers a print page break, so readers can cite the page
+// numbers of the print edition: the page labeled label starts in the book
+// file at path, at the element with the given id or, if id is "", at the
+// top of the file. AddTOC lists the page breaks, in the order they were
+// registered, in the NCX pageList.
+// Options, if not nil, must be a *ugarit.PageBreakOptions. If it has
+// Insert set, an empty span is inserted into the page, with the given id or
+// a generated one.
+func (b *Book) AddPageBreak(label string, path string, id string, options interface{}) error {
+   var opt *ugarit.PageBreakOptions
+   var n int
+   var r io.Reader
+   var page []byte
+   var err error
+
+   if b.err != nil {
+      return b.err
+   }
+
+   if options != nil {
+      switch options.(type) {
+      case *ugarit.PageBreakOptions:
+         opt = options.(*ugarit.PageBreakOptions)
+      default:
+         return ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   n = b.lookup(path)
+   if n < 0 {
+      return ugarit.ErrorFileNotFound
+   }
+
+   if opt != nil && opt.Insert {
+      if id == "" {
+         id = fmt.Sprintf("pagebreak%d", len(b.pages)+1)
+      }
+
+      r, err = b.Open(path)
+      if err != nil {
+         return err
+      }
+      page, err = io.ReadAll(r)
+      if err != nil {
+         return err
+      }
+
+      page, err = ugarit.InsertPageBreak(page, id, label, opt.Before, false)
+      if err != nil {
+         return err
+      }
+
+      _, _, err = b.addfile(b.Package.Manifest[n].Href, bytes.NewReader(page), b.Package.Manifest[n].ID)
+      if err != nil {
+         return err
+      }
+   }
+
+   b.pages = append(b.pages, pageBreak{
+      label: label,
+      href:  b.Package.Manifest[n].Href,
+      id:    id,
+   })
+
+   return nil
+}
+
+// SetPageBreakSource names the print edition the page breaks come from,
+// usually by its ISBN ("urn:isbn:..."), as dc:source metadata.
+func (b *Book) SetPageBreakSource(source string) {
+   for _, dc := range b.Package.Metadata.DC {
+      if dc.XMLName.Local == "dc:source" && dc.Data == source {
+         return
+      }
+   }
+
+   b.Package.Metadata.DC = append(b.Package.Metadata.DC, DCElement{
+      XMLName: xml.Name{Local: "dc:source"},
+      Data:    source,
+   })
+}
+
+// addPageList passes the page breaks to gen, if it makes page lists.
+func (b *Book) addPageList(gen ugarit.IndexGenerator) error {
+   var plg ugarit.PageListGenerator
+   var ok bool
+   var href string
+   var txt *html.Node
+   var err error
+
+   plg, ok = gen.(ugarit.PageListGenerator)
+   if !ok {
+      return nil
+   }
+
+   for _, pb := range b.pages {
+      href = relPath(pb.href)
+      if pb.id != "" {
+         href += "#" + pb.id
+      }
+
+      txt = &html.Node{
+         Type: html.TextNode,
+         Data: pb.label,
+      }
+      err = plg.AddPageTarget(&html.Node{
+         FirstChild: txt,
+         LastChild:  txt,
+         Type:       html.ElementNode,
+         DataAtom:   atom.A,
+         Data:       "a",
+         Attr: []html.Attribute{
+            html.Attribute{
+               Key: "href",
+               Val: href,
+            },
+         },
+      })
+      if err != nil {
+         return err
+      }
+   }
+
+   return nil
+}
+
+// AddPageTarget appends a page to the NCX pageList. Arabic numbered pages
+// are normal pages, roman numbered ones front matter pages and the others
+// special pages.
+func (gen *IndexGenerator) AddPageTarget(item *html.Node) error {
+   var pt PageTarget
+
+   gen.id++
+
+   if gen.doc.PageList == nil {
+      gen.doc.PageList = &PageList{}
+   }
+
+   pt = PageTarget{
+      Id:        fmt.Sprintf("page%d", len(gen.doc.PageList.Targets)+1),
+      Type:      "special",
+      PlayOrder: fmt.Sprintf("%d", gen.id),
+   }
+
+   if item.FirstChild != nil {
+      pt.Label = item.FirstChild.Data
+   }
+
+   for _, a := range item.Attr {
+      if a.Key == "href" {
+         pt.Content.Src = a.Val
+      }
+   }
+
+   switch {
+   case romanNumeral.MatchString(pt.Label):
+      pt.Type = "front"
+   default:
+      if _, err := strconv.Atoi(pt.Label); err == nil {
+         pt.Type = "normal"
+         pt.Value = pt.Label
+      }
+   }
+
+   gen.doc.PageList.Targets = append(gen.doc.PageList.Targets, pt)
+
+   return nil
+}
@@ -0,0 +1,82 @@
+package epub20_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestNoPageList(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("a.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub20.EPubOptions{TOCItemTitle: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	gen, _ := epub20.NewIndexGenerator("en", "id", "T", "A", b)
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The NCX DTD does not allow an empty pageList
+	if ncx := testutil.ZipEntry(t, buf.Bytes(), ".ncx"); bytes.Contains(ncx, []byte("pageList")) {
+		t.Errorf("ncx: got %s", ncx)
+	}
+}
+
+func TestPageList(t *testing.T) {
+	var buf testutil.BufCloser
+
+	ch2 := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Ch2</title></head><body><p>a</p><p id="p2">b</p></body></html>`
+
+	b, err := epub20.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("ch2.xhtml", "application/xhtml+xml", strings.NewReader(ch2), "", &epub20.EPubOptions{TOCItemTitle: "Ch2"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, label := range []string{"iv", "7", "A-1"} {
+		if err = b.AddPageBreak(label, "ch2.xhtml", "", &ugarit.PageBreakOptions{Insert: true, Before: "p2"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gen, err := epub20.NewIndexGenerator("en", "id", "T", "", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	r, err := b.Open("toc.ncx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	for _, want := range []string{
+		`<pageList><pageTarget id="page1" type="front" playOrder="2"><navLabel><text>iv</text></navLabel><content src="ch2.xhtml#pagebreak1"></content></pageTarget>`,
+		`<pageTarget id="page2" type="normal" value="7" playOrder="3">`,
+		`<pageTarget id="page3" type="special" playOrder="4">`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ncx: %s missing in %s", want, data)
+		}
+	}
+	r, _ = b.Open("ch2.xhtml")
+	data, _ = io.ReadAll(r)
+	if !strings.Contains(string(data), `<span id="pagebreak3" title="A-1"></span><p id="p2">`) {
+		t.Errorf("page break: got %s", data)
+	}
+}
@@ -0,0 +1,155 @@
+package epub30
+
+import (
+   "io"
+   "strings"
+   "github.com/PuerkitoBio/goquery"
+)
+
+// a11yProperties lists the metadata properties SetAccessibility writes
+var a11yProperties = []string{
+   "schema:accessMode",
+   "schema:accessModeSufficient",
+   "schema:accessibilityFeature",
+   "schema:accessibilityHazard",
+   "schema:accessibilitySummary",
+   "dcterms:conformsTo",
+   "a11y:certifiedBy",
+}
+
+// SetAccessibility replaces the accessibility metadata of the book with the
+// contents of a, also made available through New. Each AccessMode,
+// AccessModeSufficient, Feature and Hazard entry becomes a meta of its own.
+// AnalyzeAccessibility may provide a starting point.
+func (b *Book) SetAccessibility(a *Accessibility) {
+   b.dropMeta(func(m Metatag) bool {
+      for _, p := range a11yProperties {
+         if m.Property == p && m.Refines == "" {
+            return true
+         }
+      }
+      return false
+   })
+
+   if a == nil {
+      return
+   }
+
+   for _, p := range []struct {
+      property string
+      values   []string
+   }{
+      {"schema:accessMode", a.AccessMode},
+      {"schema:accessModeSufficient", a.AccessModeSufficient},
+      {"schema:accessibilityFeature", a.Feature},
+      {"schema:accessibilityHazard", a.Hazard},
+      {"schema:accessibilitySummary", []string{a.Summary}},
+      {"dcterms:conformsTo", []string{a.ConformsTo}},
+      {"a11y:certifiedBy", []string{a.CertifiedBy}},
+   } {
+      for _, v := range p.values {
+         if v != "" {
+            b.AddMetadata(p.property, v)
+         }
+      }
+   }
+}
+
+// AnalyzeAccessibility infers from the book contents the access modes and
+// the features it has: textual, visual and auditory contents, alternative
+// text of every image, MathML, table of contents, headings, page list and
+// page break markers, synchronized audio. Hazards, summary and conformance
+// can't be inferred, so they are left for the caller to fill before calling
+// SetAccessibility. Call it after AddTOC.
+func (b *Book) AnalyzeAccessibility() (*Accessibility, error) {
+   var a Accessibility
+   var doc *goquery.Document
+   var r io.Reader
+   var err error
+   var textual, visual, auditory bool
+   var images, described int
+   var math, headings, markers, toc, overlays bool
+
+   for _, m := range b.Package.Manifest {
+      if m.MediaOverlay != "" {
+         overlays = true
+      }
+      if strings.Contains(" "+m.Properties+" ", " nav ") || m.MediaType == "application/x-dtbncx+xml" {
+         toc = true
+      }
+      if m.MediaType != "application/xhtml+xml" {
+         continue
+      }
+
+      // Files registered by AddReference have no contents
+      r, err = b.Open(m.Href)
+      if err != nil {
+         continue
+      }
+      doc, err = goquery.NewDocumentFromReader(r)
+      if err != nil {
+         return nil, err
+      }
+
+      if strings.TrimSpace(doc.Find("body").Text()) != "" {
+         textual = true
+      }
+      // An empty alt marks a decorative image, which is fine
+      doc.Find("img, [role=img]").Each(func(_ int, sel *goquery.Selection) {
+         images++
+         if _, ok := sel.Attr("alt"); ok || sel.AttrOr("aria-label", "") != "" || sel.AttrOr("aria-labelledby", "") != "" {
+            described++
+         }
+      })
+      if doc.Find("img, svg, canvas, video").Length() > 0 {
+         visual = true
+      }
+      if doc.Find("audio, video").Length() > 0 {
+         auditory = true
+      }
+      if doc.Find("math").Length() > 0 {
+         math = true
+      }
+      if doc.Find("h1, h2, h3, h4, h5, h6").Length() > 0 {
+         headings = true
+      }
+      if doc.Find(`[role="doc-pagebreak"]`).Length() > 0 {
+         markers = true
+      }
+   }
+
+   for _, mode := range []struct {
+      name string
+      has  bool
+   }{{"textual", textual}, {"visual", visual}, {"auditory", auditory}} {
+      if mode.has {
+         a.AccessMode = append(a.AccessMode, mode.name)
+      }
+   }
+   if len(a.AccessMode) > 0 {
+      a.AccessModeSufficient = []string{strings.Join(a.AccessMode, ",")}
+   }
+   // Described images and no sound: the text alone is enough
+   if textual && len(a.AccessMode) > 1 && images == described && !auditory {
+      a.AccessModeSufficient = append(a.AccessModeSufficient, "textual")
+   }
+
+   for _, feat := range []struct {
+      name string
+      has  bool
+   }{
+      {"alternativeText", images > 0 && images == described},
+      {"MathML", math},
+      {"tableOfContents", toc},
+      {"structuralNavigation", headings},
+      {"pageNavigation", len(b.pages) > 0},
+      {"pageBreakMarkers", markers},
+      {"synchronizedAudioText", overlays},
+   } {
+      if feat.has {
+         a.Feature = append(a.Feature, feat.name)
+      }
+   }
+
+   return &a, nil
+}
@@ -0,0 +1,77 @@
+package epub30_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestAccessibility(t *testing.T) {
+	var buf testutil.BufCloser
+
+	page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title></head><body><h1>One</h1><img src="a.png" alt="A cat"/><img src="b.png" alt=""/><math xmlns="http://www.w3.org/1998/Math/MathML"><mi>x</mi></math></body></html>`
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil,
+		&epub30.Accessibility{Summary: "Replaced", Hazard: []string{"flashing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("p.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub30.EPubOptions{TOCItemTitle: "P"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddPageBreak("1", "p.xhtml", "", &ugarit.PageBreakOptions{Insert: true}); err != nil {
+		t.Fatal(err)
+	}
+	gen, _ := epub30.NewIndexGenerator()
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := b.AnalyzeAccessibility()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(a.AccessMode, " "); got != "textual visual" {
+		t.Errorf("access modes: got %q", got)
+	}
+	if got := strings.Join(a.AccessModeSufficient, " "); got != "textual,visual textual" {
+		t.Errorf("sufficient access modes: got %q", got)
+	}
+	if got := strings.Join(a.Feature, " "); got != "alternativeText MathML tableOfContents structuralNavigation pageNavigation pageBreakMarkers" {
+		t.Errorf("features: got %q", got)
+	}
+
+	a.Hazard = []string{"none"}
+	a.Summary = "Fully described images."
+	a.ConformsTo = epub30.ConformsToEPUBA11y11WCAG21AA
+	b.SetAccessibility(a)
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, m := range br.Metadata().Meta {
+		got[m.Property] = append(got[m.Property], m.Value)
+	}
+	for p, want := range map[string]string{
+		"schema:accessMode":           "textual visual",
+		"schema:accessModeSufficient": "textual,visual textual",
+		"schema:accessibilityFeature": "alternativeText MathML tableOfContents structuralNavigation pageNavigation pageBreakMarkers",
+		"schema:accessibilityHazard":  "none",
+		"schema:accessibilitySummary": "Fully described images.",
+		"dcterms:conformsTo":          "EPUB Accessibility 1.1 - WCAG 2.1 Level AA",
+	} {
+		if strings.Join(got[p], " ") != want {
+			t.Errorf("%s: got %q", p, got[p])
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package epub30
+
+import (
+   "io"
+   "bytes"
+   "regexp"
+   "strings"
+   "io/fs"
+   "net/url"
+   "path"
+   "github.com/luisfurquim/ugarit"
+   "github.com/PuerkitoBio/goquery"
+)
+
+// Attributes referencing the resources a page needs
+var assetAttrs = []struct {
+   sel  string
+   attr string
+}{
+   {"img", "src"},
+   {"img", "srcset"},
+   {"link", "href"},
+   {"script", "src"},
+   {"video", "src"},
+   {"video", "poster"},
+   {"audio", "src"},
+   {"source", "src"},
+   {"source", "srcset"},
+   {"track", "src"},
+}
+
+// url() values and @import strings in CSS
+var cssRefs = regexp.MustCompile(`url\(\s*(["']?)([^"')]+)(["']?)\s*\)|@import\s+(["'])([^"']+)(["'])`)
+
+// addAssets adds to the book the local resources referenced by the page at
+// pagePath, fetching them from assets, which is either a fs.FS or an
+// AssetFetch. Stylesheets are scanned for their own references as well.
+// Resources already in the book are not fetched again. It returns the page
+// contents, with root-relative references ("/img/a.png") rewritten as
+// relative to the page.
+func (b *Book) addAssets(pagePath string, data []byte, assets interface{}) ([]byte, error) {
+   var doc *goquery.Document
+   var err error
+   var changed bool
+   var shtml string
+
+   switch assets.(type) {
+   case fs.FS, AssetFetch:
+   default:
+      return nil, ugarit.ErrorInvalidOptionType
+   }
+
+   doc, err = goquery.NewDocumentFromReader(bytes.NewReader(data))
+   if err != nil {
+      return nil, err
+   }
+
+   for _, aa := range assetAttrs {
+      doc.Find(aa.sel).EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+         var val, newVal string
+         var ok bool
+
+         val, ok = sel.Attr(aa.attr)
+         if !ok {
+            return true
+         }
+
+         // Only stylesheets are resources, other links are navigation
+         if aa.sel == "link" && !strings.Contains(" "+strings.ToLower(sel.AttrOr("rel", ""))+" ", " stylesheet ") {
+            return true
+         }
+
+         if aa.attr == "srcset" {
+            newVal, err = b.addSrcset(pagePath, val, assets)
+         } else {
+            newVal, err = b.addAsset(pagePath, val, assets)
+         }
+         if err != nil {
+            return false
+         }
+
+         if newVal != val {
+            sel.SetAttr(aa.attr, newVal)
+            changed = true
+         }
+         return true
+      })
+      if err != nil {
+         return nil, err
+      }
+   }
+
+   doc.Find("style").EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+      var css []byte
+
+      css, err = b.addCSSAssets(pagePath, []byte(sel.Text()), assets)
+      if err == nil && string(css) != sel.Text() {
+         sel.SetText(string(css))
+         changed = true
+      }
+      return err == nil
+   })
+   if err != nil {
+      return nil, err
+   }
+
+   doc.Find("[style]").EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+      var css []byte
+
+      val := sel.AttrOr("style", "")
+      css, err = b.addCSSAssets(pagePath, []byte(val), assets)
+      if err == nil && string(css) != val {
+         sel.SetAttr("style", string(css))
+         changed = true
+      }
+      return err == nil
+   })
+   if err != nil {
+      return nil, err
+   }
+
+   // Pages are only serialized again when some reference changed
+   if !changed {
+      return data, nil
+   }
+
+   shtml, err = renderXHTML(doc)
+   if err != nil {
+      return nil, err
+   }
+
+   return []byte(shtml), nil
+}
+
+// addSrcset adds the images of a srcset attribute value.
+func (b *Book) addSrcset(fromPath string, srcset string, assets interface{}) (string, error) {
+   var candidates []string
+   var err error
+
+   candidates = strings.Split(srcset, ",")
+   for i, c := range candidates {
+      fields := strings.Fields(c)
+      if len(fields) == 0 {
+         continue
+      }
+      fields[0], err = b.addAsset(fromPath, fields[0], assets)
+      if err != nil {
+         return "", err
+      }
+      candidates[i] = strings.Join(fields, " ")
+   }
+
+   return strings.Join(candidates, ", "), nil
+}
+
+// addCSSAssets adds the resources referenced by the stylesheet at fromPath
+// (or the page at fromPath, for embedded styles), returning it with
+// root-relative references rewritten.
+func (b *Book) addCSSAssets(fromPath string, css []byte, assets interface{}) ([]byte, error) {
+   var res bytes.Buffer
+   var last int
+   var ref, newRef string
+   var err error
+
+   for _, m := range cssRefs.FindAllSubmatchIndex(css, -1) {
+      // The first alternative is url(), the second @import "..."
+      g := 2
+      if m[4] < 0 {
+         g = 5
+      }
+
+      ref = string(css[m[2*g]:m[2*g+1]])
+      newRef, err = b.addAsset(fromPath, strings.TrimSpace(ref), assets)
+      if err != nil {
+         return nil, err
+      }
+
+      res.Write(css[last:m[2*g]])
+      res.WriteString(newRef)
+      last = m[2*g+1]
+   }
+
+   if last == 0 {
+      return css, nil
+   }
+
+   res.Write(css[last:])
+   return res.Bytes(), nil
+}
+
+// addAsset adds the local resource ref points to, as found in the file at
+// fromPath, unless it is already in the book. It returns ref, rewritten as
+// relative to fromPath if it was root-relative.
+func (b *Book) addAsset(fromPath string, ref string, assets interface{}) (string, error) {
+   var refPath, suffix, target string
+   var rc io.ReadCloser
+   var data []byte
+   var w io.Writer
+   var err error
+
+   // External and in-document references are left alone
+   if ref == "" || ref[0] == '#' || strings.HasPrefix(ref, "//") {
+      return ref, nil
+   }
+   if u, err := url.Parse(ref); err != nil || u.Scheme != "" {
+      return ref, nil
+   }
+
+   refPath = ref
+   if i := strings.IndexAny(ref, "?#"); i >= 0 {
+      refPath, suffix = ref[:i], ref[i:]
+   }
+   if refPath == "" {
+      return ref, nil
+   }
+
+   target, err = url.PathUnescape(refPath)
+   if err != nil {
+      return "", err
+   }
+
+   if target[0] == '/' {
+      target = path.Clean(target[1:])
+   } else {
+      target = path.Join(path.Dir(fromPath), target)
+   }
+
+   if target == "." || target == ".." || strings.HasPrefix(target, "../") {
+      return "", ugarit.ErrorInvalidPathname
+   }
+
+   if _, ok := b.ManifIndex[target]; !ok {
+      switch a := assets.(type) {
+      case AssetFetch:
+         rc, err = a(target)
+      case fs.FS:
+         rc, err = a.Open(target)
+      }
+      if err != nil {
+         return "", err
+      }
+
+      data, err = io.ReadAll(rc)
+      rc.Close()
+      if err != nil {
+         return "", err
+      }
+
+      mimetype := ugarit.MimeType(target, data)
+
+      // Registered before scanning, so cyclic @imports stop here
+      _, w, err = b.AddFile(target, mimetype, nil, "", nil)
+      if err != nil {
+         return "", err
+      }
+
+      if mimetype == "text/css" {
+         data, err = b.addCSSAssets(target, data, assets)
+         if err != nil {
+            return "", err
+         }
+      }
+
+      _, err = w.Write(data)
+      if err != nil {
+         return "", err
+      }
+   }
+
+   if refPath[0] == '/' {
+      return relHref(path.Dir(fromPath), refPath[1:]) + suffix, nil
+   }
+
+   return ref, nil
+}
+
+// relHref returns the href of target (relative to the root folder) as
+// seen from the dir folder.
+func relHref(dir string, target string) string {
+   var from, to []string
+
+   if dir != "." {
+      from = strings.Split(dir, "/")
+   }
+   to = strings.Split(path.Clean(target), "/")
+
+   for len(from) > 0 && len(to) > 1 && from[0] == to[0] {
+      from, to = from[1:], to[1:]
+   }
+
+   return strings.Repeat("../", len(from)) + strings.Join(to, "/")
+}
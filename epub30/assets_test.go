@@ -0,0 +1,96 @@
+package epub30_test
+
+import (
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestAddPageAssets(t *testing.T) {
+	var buf testutil.BufCloser
+	var fetched []string
+
+	assets := fstest.MapFS{
+		"img/a.png":      {Data: []byte("PNG")},
+		"img/a2x.png":    {Data: []byte("PNG2")},
+		"img/bg.png":     {Data: []byte("BG")},
+		"css/main.css":   {Data: []byte(`@import "base.css"; body { background: url('../img/bg.png') } i { background: url(data:image/png;base64,AA==) }`)},
+		"css/base.css":   {Data: []byte(`@import url(main.css); p { background: url(/img/bg.png) }`)},
+		"js/app.js":      {Data: []byte("1;")},
+		"audio/a.mp3":    {Data: []byte("ID3")},
+		"media/clip.mp4": {Data: []byte("MP4")},
+	}
+	page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title>
+<link rel="stylesheet" href="/css/main.css"/><link rel="next" href="p2.xhtml"/><script src="../js/app.js"></script></head>
+<body><img src="../img/a.png" srcset="../img/a.png 1x, /img/a2x.png 2x"/><img src="http://example.com/x.png"/>
+<audio><source src="../audio/a.mp3"/></audio><div style="background: url(../img/bg.png)"></div></body></html>`
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("text/p.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub30.EPubOptions{TOCItemTitle: "P", Assets: fs.FS(assets)}); err != nil {
+		t.Fatalf("AddPage: %s", err)
+	}
+
+	// Resources already in the book are not fetched again
+	fetch := epub30.AssetFetch(func(p string) (io.ReadCloser, error) {
+		fetched = append(fetched, p)
+		return assets.Open(p)
+	})
+	page2 := `<html xmlns="http://www.w3.org/1999/xhtml"><body><img src="/img/a.png"/><video src="/media/clip.mp4"></video></body></html>`
+	if _, _, _, err = b.AddPage("p2.xhtml", "application/xhtml+xml", strings.NewReader(page2), "", &epub30.EPubOptions{TOCItemTitle: "P2", Assets: fetch}); err != nil {
+		t.Fatalf("AddPage with fetch: %s", err)
+	}
+	if strings.Join(fetched, " ") != "media/clip.mp4" {
+		t.Errorf("fetched: got %v", fetched)
+	}
+
+	missing := `<html xmlns="http://www.w3.org/1999/xhtml"><body><img src="nothere.png"/></body></html>`
+	if _, _, _, err = b.AddPage("p3.xhtml", "application/xhtml+xml", strings.NewReader(missing), "", &epub30.EPubOptions{TOCItemTitle: "P3", Assets: fs.FS(assets)}); err == nil {
+		t.Errorf("missing asset: no error")
+	}
+
+	for p, mt := range map[string]string{
+		"img/a.png":      "image/png",
+		"img/a2x.png":    "image/png",
+		"img/bg.png":     "image/png",
+		"css/main.css":   "text/css",
+		"css/base.css":   "text/css",
+		"js/app.js":      "application/javascript",
+		"audio/a.mp3":    "audio/mpeg",
+		"media/clip.mp4": "video/mp4",
+	} {
+		r, err := b.Open(p)
+		if err != nil {
+			t.Errorf("%s: %s", p, err)
+			continue
+		}
+		for _, m := range b.Package.Manifest {
+			if m.Href == p && m.MediaType != mt {
+				t.Errorf("%s: got %s", p, m.MediaType)
+			}
+		}
+		data, _ := io.ReadAll(r)
+		if p == "css/base.css" && !strings.Contains(string(data), "url(../img/bg.png)") {
+			t.Errorf("%s: not rewritten: %s", p, data)
+		}
+	}
+
+	r, _ := b.Open("text/p.xhtml")
+	data, _ := io.ReadAll(r)
+	for _, want := range []string{`href="../css/main.css"`, `srcset="../img/a.png 1x, ../img/a2x.png 2x"`, `href="p2.xhtml"`, `src="http://example.com/x.png"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("page: %s missing in %s", want, data)
+		}
+	}
+	if n := len(b.AllFiles()); n != 10 {
+		t.Errorf("AllFiles: got %d %v", n, b.AllFiles())
+	}
+}
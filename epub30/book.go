@@ -5,6 +5,7 @@ import (
    "io"
    "fmt"
    "time"
+   "bytes"
    "sort"
    "regexp"
    "strings"
@@ -42,7 +43,10 @@ import (
 //
 // @PageProgression -- PageProgression use "ltr" (left-to-right) or "rtl" (right-to-left)
 //
-// @bookversion -- provide a versioner interface or use the package provided one which just generate a version string using the current time
+// @bookversion -- provide a versioner interface or use the package provided one which just generate a version string using the build time (see SetBuildTime)
+//
+// @options -- optionally, a *Rendition making it a fixed-layout book (see SetRendition)
+// and an *Accessibility describing its accessibility (see SetAccessibility)
 func New(
    target io.WriteCloser, // where to save the epub contents
    title []string, // eBook title
@@ -55,8 +59,9 @@ func New(
    metatag []Metatag, // Any epub metatags go here
    pageProgression string, // PageProgression use "ltr" (left-to-right) or "rtl" (right-to-left)
    // provide a versioner interface or use the package provided one
-   // which just generate a version string using the current time
-   bookversion ugarit.Versioner) (*Book, error) {
+   // which just generate a version string using the build time
+   bookversion ugarit.Versioner,
+   options ...interface{}) (*Book, error) {
    var b Book
    var sig *Signature
    var ids []Identifier
@@ -66,29 +71,6 @@ func New(
    b.index = make(TOC, 0, 4)
    b.cwd = "/"
    b.fd = target
-   b.zfd = zip.NewWriter(target)
-
-   header := &zip.FileHeader{
-      Name:   "mimetype",
-      Method: zip.Store,
-   }
-   f, err := b.zfd.CreateHeader(header)
-   if err != nil {
-      return nil, err
-   }
-   _, err = f.Write([]byte("application/epub+zip"))
-   if err != nil {
-      return nil, err
-   }
-
-   f, err = b.zfd.Create("META-INF/container.xml")
-   if err != nil {
-      return nil, err
-   }
-   _, err = f.Write([]byte(fmt.Sprintf(rootfolder, b.RootFolder)))
-   if err != nil {
-      return nil, err
-   }
 
    ids = make([]Identifier, len(identifier))
    for i, id := range identifier {
@@ -96,6 +78,9 @@ func New(
          Data: id,
          ID:   "pub-id",
       }
+      if i > 0 {
+         ids[i].ID = fmt.Sprintf("pub-id%d", i)
+      }
    }
 
    if bookversion != nil {
@@ -103,6 +88,10 @@ func New(
          Property: "ibooks:version",
          Data:     bookversion.Next(),
       })
+      switch bookversion.(type) {
+      case Versioner, *Versioner:
+         b.clockVersion = true
+      }
    }
 
    b.Package = Package{
@@ -117,7 +106,7 @@ func New(
          Title:      title,
          Language:   language,
          Identifier: ids,
-         Creator:    creator,
+         Creator:    append([]Author(nil), creator...),
          Publisher:  publisher,
          Date:       date,
          Signature:  sig,
@@ -139,9 +128,24 @@ func New(
       //    b.Package.Langattr = "en"
    }
 
-   b.subSection = ugarit.NewArabicNumbering("Chapter", true)
-
    b.ManifIndex = map[string]string{}
+   b.files = map[string]*file{}
+
+   b.refineCreators()
+
+   for _, o := range options {
+      switch o.(type) {
+      case *Rendition:
+         err := b.SetRendition(o.(*Rendition))
+         if err != nil {
+            return nil, err
+         }
+      case *Accessibility:
+         b.SetAccessibility(o.(*Accessibility))
+      default:
+         return nil, ugarit.ErrorInvalidOptionType
+      }
+   }
 
    return &b, nil
 }
@@ -153,10 +157,29 @@ func New(
 // register as having the provided mimetype and making it to figure in the book index.
 // If src is nil, it returns a valid io.Writer.
 // If src is not nil, it copies its content to the file and return a nil io.Writer.
+// Adding a page already in the book (e.g. patching a page of a book loaded by
+// Open) replaces its contents and its TOC entry, keeping its place in the
+// spine.
 // If path collides with a reserved path, it returns an error.
 // If the page is to be added to the TOC, provide an EPubOptions object containing
-// a TOCTitle and a TOCItemTitle; OR a TOCContent object.
+// a TOCTitle and a TOCItemTitle; OR a TOCContent object. EPubOptions without
+// any of them leave the page out of the TOC.
 // TOC support is still alpha code and will be improved in the future
+// If the EPubOptions object has Assets, the local images, stylesheets (and
+// what they import), scripts and media the page references are fetched
+// from it and added to the E-Book, once. References relative to the root
+// folder ("/img/a.png") are rewritten as relative to the page. A resource
+// missing from Assets makes AddPage fail.
+// If the EPubOptions object has a Landmark, the page gets this semantic
+// role: its body (or its only section) epub:type, a landmark in the nav made
+// by AddTOC and a guide reference.
+// If the EPubOptions object has Headings, TOC entries pointing to the page
+// headings are nested under the page entry (see addHeadings); headings
+// without an id get one.
+// The Rendition of the EPubOptions object sets the page spread and overrides
+// the book fixed-layout settings for the page. XHTML pages of pre-paginated
+// books get the viewport of the book (or of the page Rendition) when they have
+// none.
 func (b *Book) AddPage(path string, mimetype string, src io.Reader, id string, options interface{}) (string, io.Writer, ugarit.TOCRef, error) {
    var w io.Writer
    var err error
@@ -165,6 +188,17 @@ func (b *Book) AddPage(path string, mimetype string, src io.Reader, id string, o
    var tc *TOCContent
    var doc *goquery.Document
    var shtml string
+   var data []byte
+   var pagePath string
+   var rend Rendition
+   var si SpineItem
+   var heads []ugarit.Heading
+   var page *TOCContent
+   var existed bool
+
+   if b.err != nil {
+      return "", nil, nil, b.err
+   }
 
    if options != nil {
       switch options.(type) {
@@ -176,33 +210,102 @@ func (b *Book) AddPage(path string, mimetype string, src io.Reader, id string, o
                return "", nil, nil, err
             }
             opt.Prop = append(opt.Prop,opt.FilterHTML(doc.Nodes)...)
-            shtml, err = doc.Html()
+            shtml, err = renderXHTML(doc)
             if err != nil {
                return "", nil, nil, err
             }
-            src = strings.NewReader("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE html>\n" + shtml)
+            src = strings.NewReader(shtml)
          }
 
          if src != nil && opt.Width != 0 && opt.Height != 0 {
-            doc, err = goquery.NewDocumentFromReader(src)
+            src, err = setViewport(src, opt.Width, opt.Height)
             if err != nil {
                return "", nil, nil, err
             }
-            doc.Find("HEAD").Each(func(_ int, s *goquery.Selection) {
-					s.AppendHtml(fmt.Sprintf(`<meta name="viewport" content="width=%d, height=%d"></meta>`, opt.Width, opt.Height))
-				})
-            shtml, err = doc.Html()
+         }
+
+         if opt.Rendition != nil {
+            err = opt.Rendition.check()
             if err != nil {
                return "", nil, nil, err
             }
-            src = strings.NewReader("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE html>\n" + shtml)
-			}
+         }
+
+         // Checked before anything is added to the book
+         if opt.TOCItemTitle == "" && (opt.TOCTitle != "" || opt.TOC != nil || opt.Headings != nil) {
+            return "", nil, nil, ugarit.ErrorTOCItemTitleNotFound
+         }
+         if _, ok := opt.TOC.(*TOCContent); opt.TOC != nil && !ok {
+            return "", nil, nil, ugarit.ErrorInvalidOptionType
+         }
 
       default:
          return "", nil, nil, ugarit.ErrorInvalidOptionType
       }
    }
 
+   // Fixed-layout pages without a viewport get the book one
+   if src != nil && mimetype == "application/xhtml+xml" && (opt == nil || opt.Width == 0 || opt.Height == 0) {
+      rend = b.rendition
+      if opt != nil && opt.Rendition != nil && opt.Rendition.Layout != "" {
+         rend.Layout = opt.Rendition.Layout
+      }
+      if opt != nil && opt.Rendition != nil && opt.Rendition.Width != 0 && opt.Rendition.Height != 0 {
+         rend.Width, rend.Height = opt.Rendition.Width, opt.Rendition.Height
+      }
+      if rend.Layout == LayoutPrePaginated && rend.Width != 0 && rend.Height != 0 {
+         src, err = setViewport(src, rend.Width, rend.Height)
+         if err != nil {
+            return "", nil, nil, err
+         }
+      }
+   }
+
+   if src != nil && opt != nil && opt.Assets != nil {
+      data, err = io.ReadAll(src)
+      if err != nil {
+         return "", nil, nil, err
+      }
+      pagePath = path
+      if opt.FilterPath != nil {
+         pagePath = opt.FilterPath(path)
+      }
+      pos = len(b.Package.Manifest)
+      data, err = b.addAssets(strings.TrimLeft(pagePath, "/"), data, opt.Assets)
+      if err != nil {
+         // Drops the assets added before the failure
+         for len(b.Package.Manifest) > pos {
+            b.removeItem(len(b.Package.Manifest) - 1)
+         }
+         return "", nil, nil, err
+      }
+      src = bytes.NewReader(data)
+   }
+
+   if src != nil && opt != nil && opt.Landmark != "" && mimetype == "application/xhtml+xml" {
+      data, err = io.ReadAll(src)
+      if err != nil {
+         return "", nil, nil, err
+      }
+      data, err = ugarit.InsertEpubType(data, ugarit.LandmarkRole(opt.Landmark))
+      if err != nil {
+         return "", nil, nil, err
+      }
+      src = bytes.NewReader(data)
+   }
+
+   if src != nil && opt != nil && opt.Headings != nil && mimetype == "application/xhtml+xml" {
+      data, err = io.ReadAll(src)
+      if err != nil {
+         return "", nil, nil, err
+      }
+      data, heads, err = ugarit.ScanHeadings(data, opt.Headings.Selector)
+      if err != nil {
+         return "", nil, nil, err
+      }
+      src = bytes.NewReader(data)
+   }
+
    pos = len(b.Package.Manifest)
 
    id, w, err = b.AddFile(path, mimetype, src, id, opt)
@@ -210,72 +313,90 @@ func (b *Book) AddPage(path string, mimetype string, src io.Reader, id string, o
       return "", w, nil, err
    }
 
+   // The file was already in the manifest (e.g. replacing a loaded one)
+   existed = pos == len(b.Package.Manifest)
+   if existed {
+      for pos=0; pos<len(b.Package.Manifest) && b.Package.Manifest[pos].ID!=id; pos++ {}
+   }
+
    //   fmt.Printf("OPTIONS: %#v\n",options)
 
-   if opt != nil {
-      if opt.TOCItemTitle == "" {
-         return "", w, nil, ugarit.ErrorTOCItemTitleNotFound
+   if opt != nil && opt.TOCItemTitle != "" {
+      page = &TOCContent{
+         ndx:        pos,
+         Title:      opt.TOCItemTitle,
+         index:      make(TOC, 0, 4),
       }
+      addHeadings(page, heads, opt.Headings)
 
+      tc = page
       if opt.TOCTitle != "" {
          tc = &TOCContent{
             ndx:        pos,
             Title:      opt.TOCTitle,
-            index:      make(TOC, 1, 4),
-            subSection: ugarit.NewArabicNumbering("Chapter", true),
+            index:      append(make(TOC, 0, 4), page),
          }
+      }
 
-         if opt.TOC != nil {
-            switch opt.TOC.(type) {
-            case *TOCContent:
-               opt.TOC.(*TOCContent).index = append(opt.TOC.(*TOCContent).index, tc)
-            default:
-               return "", w, nil, ugarit.ErrorInvalidOptionType
-            }
-         } else {
-            b.index = append(b.index, tc)
+      // A page added again takes the place of its TOC entry, keeping the
+      // sub-entries if it brings none
+      if parent, i := findTOC(b.index, pos); existed && parent != nil {
+         if len(page.index) == 0 {
+            page.index = parent[i].index
          }
-
-         tc.index[0] = &TOCContent{
-            ndx:        pos,
-            Title:      opt.TOCItemTitle,
-            index:      make(TOC, 0, 4),
-            subSection: ugarit.NewArabicNumbering("Chapter", true),
-         }
-
-//         tc = tc.index[0]
-
-//            fmt.Printf("TOC: %#v\n", b.index)
-      } else {
-         tc = &TOCContent{
-            ndx:        pos,
-            Title:      opt.TOCItemTitle,
-            index:      make(TOC, 0, 4),
-            subSection: ugarit.NewArabicNumbering("Chapter", true),
-         }
-
-         if opt.TOC != nil {
+         parent[i] = tc
+      } else if opt.TOC != nil {
 //               fmt.Printf("TOC before: %s\n", opt.TOC.(*TOCContent))
-            switch opt.TOC.(type) {
-            case *TOCContent:
-               opt.TOC.(*TOCContent).index = append(opt.TOC.(*TOCContent).index, tc)
+         opt.TOC.(*TOCContent).index = append(opt.TOC.(*TOCContent).index, tc)
 //                  fmt.Printf("SUBTOC: %s\n", opt.TOC.(*TOCContent))
-            default:
-               return "", w, nil, ugarit.ErrorInvalidOptionType
-            }
-         } else {
-            b.index = append(b.index, tc)
-         }
-//            fmt.Printf("TOC: %s\n", b.index)
+      } else {
+         b.index = append(b.index, tc)
       }
+//            fmt.Printf("TOC: %s\n", b.index)
+   }
 
+   if opt != nil && opt.Landmark != "" {
+      b.setLandmark(pos, opt.Landmark, opt.LandmarkTitle)
    }
 
-   b.Package.Spine.Itemref = append(b.Package.Spine.Itemref, SpineItem{IDref: id})
+   si = SpineItem{IDref: id}
+   if opt != nil && opt.Rendition != nil {
+      si.Properties = opt.Rendition.spineProperties()
+      if si.Properties != "" {
+         b.Package.Prefix = mergePrefix(b.Package.Prefix, "rendition: http://www.idpf.org/vocab/rendition/#")
+      }
+   }
+
+   // A page added again keeps its place in the spine
+   for i := range b.Package.Spine.Itemref {
+      if b.Package.Spine.Itemref[i].IDref == id {
+         if opt != nil && opt.Rendition != nil {
+            b.Package.Spine.Itemref[i].Properties = si.Properties
+         }
+         return id, w, tc, nil
+      }
+   }
+   b.Package.Spine.Itemref = append(b.Package.Spine.Itemref, si)
 
    return id, w, tc, nil
 }
 
+// findTOC looks in the index, and in its sub-entries, for the first entry
+// pointing to the whole Nth manifest item. It returns the index holding the
+// entry and its position, or nil if there is none.
+func findTOC(index TOC, n int) (TOC, int) {
+   for i, tc := range index {
+      if tc.ndx == n && tc.fragment == "" {
+         return index, i
+      }
+      if parent, j := findTOC(tc.index, n); parent != nil {
+         return parent, j
+      }
+   }
+
+   return nil, -1
+}
+
 // AddCover saves the Cover in the E-Book. Use it before saving any content to the E-Book.
 // AddCover creates/truncates the file specified by path inside the epub file,
 // registers as having the provided mimetype and makes it be the book cover.
@@ -292,6 +413,10 @@ func (b *Book) AddCover(path string, mimetype string, src io.Reader, options int
    var extension string
 //   var fileprop []string
 
+   if b.err != nil {
+      return "", nil, b.err
+   }
+
    if options != nil {
       switch options.(type) {
       case *EPubOptions:
@@ -372,13 +497,19 @@ func mkTOC(tc ugarit.TOC, gen ugarit.IndexGenerator, manif []Manifest) error {
    var tcont *TOCContent
    var err error
    var txt *html.Node
+   var href string
 
    for i=0; i<tc.TOCLen(); i++ {
       tcont = tc.TOCChild(i).(*TOCContent)
 
+      href = manif[tcont.ndx].Href
+      if tcont.fragment != "" {
+         href += "#" + tcont.fragment
+      }
+
       txt = &html.Node{
          Type: html.TextNode,
-         Data: tcont.Title,
+         Data: tcont.label(),
       }
       err = gen.AddItem(&html.Node{
          FirstChild: txt,
@@ -389,7 +520,7 @@ func mkTOC(tc ugarit.TOC, gen ugarit.IndexGenerator, manif []Manifest) error {
          Attr: []html.Attribute{
             html.Attribute{
                Key: "href",
-               Val: manif[tcont.ndx].Href,
+               Val: href,
             },
             html.Attribute{
                Key: "id",
@@ -424,24 +555,52 @@ func (b *Book) AddTOC(gen ugarit.IndexGenerator, id string) (string, error) {
    var path string
    var ref Reference
    var found bool
+   var inSpine bool
+
+   if b.err != nil {
+      return "", b.err
+   }
 
    if id == "" {
       id = gen.GetId()
    }
 
+   // The TOC being generated replaces the loaded one of the same kind
+   if b.src != nil {
+      b.dropLoaded(func(m Manifest) bool {
+         if gen.GetPropertyValue() == "nav" {
+            return strings.Contains(" "+m.Properties+" ", " nav ")
+         }
+         return m.MediaType == gen.GetMimeType()
+      })
+   }
+
    // The cover landmark is only real when AddCover ran; a dangling
    // cover.xhtml reference fails epubcheck on coverless books.
-   if b.coverPath != "" {
-      if ig, ok := gen.(*IndexGenerator); ok {
-         ig.AddLandmark(b.coverPath, "cover", "Cover")
+   if lg, ok := gen.(ugarit.LandmarkGenerator); ok {
+      if b.coverPath != "" {
+         lg.AddLandmark(b.coverPath, "cover", "Cover")
+      }
+      for _, lm := range b.landmarks {
+         lg.AddLandmark(lm.href, lm.role, lm.label)
       }
    }
 
+   err = ugarit.NumberSections(b.sections(b.index), b.subSection, "", b.numbered)
+   if err != nil {
+      return id, err
+   }
+
    err = mkTOC(b, gen, b.Package.Manifest)
    if err != nil {
       return id, err
    }
 
+   err = b.addPageList(gen)
+   if err != nil {
+      return id, err
+   }
+
    r, err = gen.GetDocument()
    if err != nil {
       //      fmt.Printf("\nError getting TOC: %s\n\n",err)
@@ -453,12 +612,24 @@ func (b *Book) AddTOC(gen ugarit.IndexGenerator, id string) (string, error) {
       id, _, err = b.addFile(path, gen.GetMimeType(), r, id, &EPubOptions{Prop: []int{prop_Nav}}, nil)
    } else {
       id, _, err = b.addFile(path, gen.GetMimeType(), r, id, &EPubOptions{}, nil)
+      if err == nil && gen.GetMimeType() == "application/x-dtbncx+xml" {
+         b.Package.Spine.Toc = id
+      }
    }
    if err == nil {
       // The TOC page reads BEFORE the content, printed-book order. Out of
       // the spine its placement is reader-defined (some append it at the
       // END of the book); first is the only deterministic choice.
-      b.Package.Spine.Itemref = append([]SpineItem{{IDref: id}}, b.Package.Spine.Itemref...)
+      // A loaded book may already have it there.
+      for _, si := range b.Package.Spine.Itemref {
+         if si.IDref == id {
+            inSpine = true
+            break
+         }
+      }
+      if !inSpine {
+         b.Package.Spine.Itemref = append([]SpineItem{{IDref: id}}, b.Package.Spine.Itemref...)
+      }
    }
 //   id, _, err = b.addFile(path, gen.GetMimeType(), r, id, &EPubOptions{}, []string{gen.GetPropertyValue()})
    //fmt.Printf("\nSaved TOC: %s\n\n", err)
@@ -497,7 +668,10 @@ func (b *Book) TOCLen() int {
    return len(b.index)
 }
 
-// SubSectionStyle sets the object to style the top level section of the TOC
+// SubSectionStyle sets the object to style the top level section of the TOC.
+// AddTOC numbers the TOC labels with it, e.g. "Chapter 1.2 Title"; the
+// subsections without a style of their own share the style of their parent
+// section. The TOC isn't numbered if no style is set.
 func (b *Book) SubSectionStyle(sty ugarit.SectionStyle) {
    b.subSection = sty
 }
@@ -533,7 +707,7 @@ func (tc TOCContent) ContentRef() string {
 }
 
 // SubSectionStyle sets the object to style this TOC subsection
-func (tc TOCContent) SubSectionStyle(sty ugarit.SectionStyle) {
+func (tc *TOCContent) SubSectionStyle(sty ugarit.SectionStyle) {
    tc.subSection = sty
 }
 
@@ -589,6 +763,10 @@ func (b *Book) AddReference(path string, mimetype string, id string, options int
    var ok bool
    var oldId string
 
+   if b.err != nil {
+      return "", b.err
+   }
+
    if oldId, ok = b.ManifIndex[path]; ok {
       return oldId, nil
    }
@@ -637,8 +815,13 @@ func (b *Book) addFile(path string, mimetype string, src io.Reader, id string, o
    var ok bool
    var oldId string
 
+   if b.err != nil {
+      return "", nil, b.err
+   }
+
+   // New contents for a file already in the book
    if oldId, ok = b.ManifIndex[path]; ok {
-      return oldId, nil, nil
+      return b.addfile(path, src, oldId)
    }
 
    if id == "" {
@@ -658,27 +841,26 @@ func (b *Book) addFile(path string, mimetype string, src io.Reader, id string, o
    return b.addfile(path, src, id)
 }
 
+// addfile stages the file contents, which are only stored in the archive by Close
 func (b *Book) addfile(path string, src io.Reader, id string) (string, io.Writer, error) {
+   var f *file
    var err error
-   var w io.Writer
-
-   if path[0] == '/' {
-      path = b.RootFolder + path
-   } else {
-      path = b.RootFolder + "/" + path
-   }
 
-   w, err = b.zfd.Create(path)
-   if err != nil {
-      return "", nil, err
-   }
+   f = &file{data: &bytes.Buffer{}}
 
    if src != nil {
-      io.Copy(w, src)
+      _, err = io.Copy(f.data, src)
+      if err != nil {
+         // The file is in the manifest but has no contents
+         b.err = err
+         return id, nil, err
+      }
+      b.files[path] = f
       return id, nil, nil
    }
 
-   return id, w, nil
+   b.files[path] = f
+   return id, f.data, nil
 }
 
 // Sets spine attributes
@@ -694,43 +876,278 @@ func (b *Book) SpineAttr(key, val string) {
 }
 
 // Closes and saves the E-Book
+// If an earlier call failed leaving the book inconsistent, or if saving it
+// fails, the target is discarded as Abort does and the error returned.
+// Give it an ugarit.AtomicFile for the book file to be either complete or
+// left untouched.
 func (b *Book) Close() error {
+   var err error
+
+   if b.err != nil {
+      b.discard()
+      return b.err
+   }
+
+   err = b.save(b.fd)
+   if err != nil {
+      b.err = err
+      b.discard()
+      return err
+   }
+
+   err = b.fd.Close()
+   b.fd = nil
+   if err != nil {
+      b.err = err
+      return err
+   }
+
+   b.err = ugarit.ErrorBookClosed
+   return nil
+}
+
+// Abort discards the book instead of saving it: the target is closed
+// without anything written to it (an ugarit.Aborter target, like
+// ugarit.AtomicFile, is aborted instead) and later calls fail with
+// ugarit.ErrorAborted.
+func (b *Book) Abort() error {
+   if b.err == nil {
+      b.err = ugarit.ErrorAborted
+   }
+   b.files = map[string]*file{}
+
+   return b.discard()
+}
+
+// Err returns the error which made the book fail, after which the calls
+// adding to it or saving it fail fast with this error: a file which could
+// not be read, a failed save, Close or Abort.
+func (b *Book) Err() error {
+   if b.err == ugarit.ErrorBookClosed || b.err == ugarit.ErrorAborted {
+      return nil
+   }
+   return b.err
+}
+
+// discard closes the target, aborting it if it can.
+func (b *Book) discard() error {
+   var err error
+
+   if b.fd == nil {
+      return nil
+   }
+
+   if a, ok := b.fd.(ugarit.Aborter); ok {
+      err = a.Abort()
+   } else {
+      err = b.fd.Close()
+   }
+   b.fd = nil
+
+   return err
+}
+
+// Validate saves the E-Book in memory and checks it the way epubcheck would,
+// so problems can be fixed before Close. See ugarit.Finding.
+func (b *Book) Validate() ([]ugarit.Finding, error) {
+   var buf bytes.Buffer
+   var br ugarit.BookReader
+   var err error
+
+   if b.err != nil {
+      return nil, b.err
+   }
+
+   err = b.save(&buf)
+   if err != nil {
+      return nil, err
+   }
+
+   br, err = ugarit.NewReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+   if err != nil {
+      return nil, err
+   }
+
+   return br.Validate(), nil
+}
+
+// save writes the epub archive to w.
+func (b *Book) save(w io.Writer) error {
    var enc *xml.Encoder
+   var zfd *zip.Writer
+   var f io.Writer
+   var err error
+   var refs []ugarit.EncryptedFile
+   var pkg Package
+   var mtime time.Time
 
-   b.Package.Metadata.Metatag = append(
-      b.Package.Metadata.Metatag,
+   mtime = b.buildTime
+   if mtime.IsZero() {
+      mtime = ugarit.BuildTime()
+   }
+
+   // dcterms:modified is set on a copy, so saving twice (Validate, then
+   // Close) does not repeat it
+   pkg = b.Package.escaped()
+   pkg.Metadata.Metatag = append(
+      append([]Metatag(nil), b.Package.Metadata.Metatag...),
       Metatag{
          Property: "dcterms:modified",
-         Data:     time.Now().Format("2006-01-02T15:04:05Z"),
+         Data:     mtime.UTC().Format("2006-01-02T15:04:05Z"),
       })
 
-   f, err := b.zfd.Create(b.RootFolder + "/content.opf")
+   zfd = zip.NewWriter(w)
+
+   f, err = zfd.CreateHeader(&zip.FileHeader{
+      Name:     "mimetype",
+      Method:   zip.Store,
+      Modified: mtime,
+   })
+   if err != nil {
+      return err
+   }
+   _, err = f.Write([]byte("application/epub+zip"))
+   if err != nil {
+      return err
+   }
+
+   f, err = createEntry(zfd, "META-INF/container.xml", mtime)
+   if err != nil {
+      return err
+   }
+   _, err = f.Write([]byte(fmt.Sprintf(rootfolder, b.RootFolder)))
+   if err != nil {
+      return err
+   }
+
+   refs = b.encryption()
+   if len(refs) > 0 {
+      f, err = createEntry(zfd, "META-INF/encryption.xml", mtime)
+      if err != nil {
+         return err
+      }
+      err = ugarit.WriteEncryption(f, refs)
+      if err != nil {
+         return err
+      }
+   }
+
+   err = b.storeFiles(zfd, mtime)
    if err != nil {
       return err
    }
 
-   f.Write([]byte(xml.Header))
+   f, err = createEntry(zfd, b.RootFolder + "/content.opf", mtime)
+   if err != nil {
+      return err
+   }
 
+   _, err = f.Write([]byte(xml.Header))
+   if err != nil {
+      return err
+   }
 
    enc = xml.NewEncoder(f)
-   err = enc.Encode(b.Package)
+   err = enc.Encode(pkg)
    if err != nil {
       return err
    }
 
-   f, err = b.zfd.Create("META-INF/com.apple.ibooks.display-options.xml")
+   f, err = createEntry(zfd, "META-INF/com.apple.ibooks.display-options.xml", mtime)
    if err != nil {
       return err
    }
 
-   f.Write([]byte(iBooksFonts))
-
-   err = b.zfd.Close()
+   // Older iBooks versions ignore the rendition metadata
+   if b.rendition.Layout == LayoutPrePaginated {
+      _, err = f.Write([]byte(iBooksFixedLayout))
+   } else {
+      _, err = f.Write([]byte(iBooksFonts))
+   }
    if err != nil {
       return err
    }
 
-   return b.fd.Close()
+   return zfd.Close()
+}
+
+// escaped returns a copy of the package with the manifest and guide hrefs
+// percent-encoded, as the book keeps them decoded, like the archive entry
+// names (see ugarit.EscapeHref).
+func (pkg Package) escaped() Package {
+   pkg.Manifest = append([]Manifest(nil), pkg.Manifest...)
+   for i := range pkg.Manifest {
+      pkg.Manifest[i].Href = ugarit.EscapeHref(pkg.Manifest[i].Href)
+   }
+
+   pkg.Guide.Reference = append([]Reference(nil), pkg.Guide.Reference...)
+   for i, ref := range pkg.Guide.Reference {
+      href, frag, found := strings.Cut(ref.Href, "#")
+      pkg.Guide.Reference[i].Href = ugarit.EscapeHref(href)
+      if found {
+         pkg.Guide.Reference[i].Href += "#" + frag
+      }
+   }
+
+   return pkg
+}
+
+// storeFiles saves the staged and loaded files in the archive, in manifest
+// order, dated mtime.
+func (b *Book) storeFiles(zfd *zip.Writer, mtime time.Time) error {
+   var w io.Writer
+   var err error
+
+   for _, m := range b.Package.Manifest {
+      f, ok := b.files[m.Href]
+      if !ok {
+         continue
+      }
+
+      w, err = createEntry(zfd, b.RootFolder + "/" + strings.TrimLeft(m.Href, "/"), mtime)
+      if err != nil {
+         return err
+      }
+
+      if f.obfuscation != "" {
+         err = b.storeObfuscated(w, f)
+      } else if f.data != nil {
+         _, err = w.Write(f.data.Bytes())
+      } else {
+         err = b.copyLoaded(w, f.loaded)
+      }
+      if err != nil {
+         return err
+      }
+   }
+
+   return nil
+}
+
+// createEntry adds to the archive a compressed file dated mtime.
+func createEntry(zfd *zip.Writer, name string, mtime time.Time) (io.Writer, error) {
+   return zfd.CreateHeader(&zip.FileHeader{
+      Name:     name,
+      Method:   zip.Deflate,
+      Modified: mtime,
+   })
+}
+
+// SetBuildTime makes the book stamped with t instead of ugarit.BuildTime():
+// the dcterms:modified date, the archive entries dates and, if New got a
+// Versioner, the version. Stamping two builds of the same contents with the
+// same time makes them byte for byte identical.
+func (b *Book) SetBuildTime(t time.Time) {
+   b.buildTime = t.UTC().Truncate(time.Second)
+
+   if !b.clockVersion {
+      return
+   }
+   for i, m := range b.Package.Metadata.Metatag {
+      if m.Property == "ibooks:version" && m.Refines == "" {
+         b.Package.Metadata.Metatag[i].Data = Versioner{Time: b.buildTime}.Next()
+      }
+   }
 }
 
 // Add custom metadata
@@ -886,10 +1303,13 @@ func (gen *IndexGenerator) GetDocument() (io.Reader, error) {
    var doc string
    var err error
 
-   // An empty <ol> is invalid; a landmarks nav with no entries goes away.
-   lmarks := gen.doc.Find("#lmarks")
-   if lmarks.Length() > 0 && lmarks.Children().Length() == 0 {
-      lmarks.Parent().Remove()
+   // An empty <ol> is invalid; landmarks and page-list navs with no
+   // entries go away.
+   for _, sel := range []string{"#lmarks", "#plist"} {
+      list := gen.doc.Find(sel)
+      if list.Length() > 0 && list.Children().Length() == 0 {
+         list.Parent().Remove()
+      }
    }
 
    doc, err = gen.doc.Html()
@@ -925,7 +1345,10 @@ func (gen *IndexGenerator) GetId() string {
 
 // Simple E-Book versioner
 func (v Versioner) Next() string {
-   return time.Now().Format("20060102150405")
+   if v.Time.IsZero() {
+      return ugarit.BuildTime().Format("20060102150405")
+   }
+   return v.Time.UTC().Format("20060102150405")
 }
 
 
@@ -956,6 +1379,27 @@ func (tc TOC) String() string {
 */
 
 
+// renderXHTML serializes a page parsed by goquery. The HTML parser keeps the
+// doctype and turns the XML declaration into a comment: both are replaced by
+// the ones XHTML pages start with.
+func renderXHTML(doc *goquery.Document) (string, error) {
+   var sb strings.Builder
+   var err error
+
+   sb.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE html>\n")
+   for n := doc.Nodes[0].FirstChild; n != nil; n = n.NextSibling {
+      if n.Type == html.DoctypeNode || n.Type == html.CommentNode && strings.HasPrefix(n.Data, "?xml") {
+         continue
+      }
+      err = html.Render(&sb, n)
+      if err != nil {
+         return "", err
+      }
+   }
+
+   return sb.String(), nil
+}
+
 func FilterPathASCDigitDash(s string) string {
    return ASCDigitDash.ReplaceAllString(s,"")
 }
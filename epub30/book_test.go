@@ -0,0 +1,336 @@
+package epub30_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestAddPageAgain(t *testing.T) {
+	var buf, buf2 testutil.BufCloser
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a", "b"} {
+		if _, _, _, err = b.AddPage(p+".xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub30.EPubOptions{TOCItemTitle: strings.ToUpper(p)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gen, _ := epub30.NewIndexGenerator("TOC")
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spine := 0
+	for range br.Spine() {
+		spine++
+	}
+	b2, err := epub30.Open(br, &buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched := strings.Replace(testutil.Chapter, "Chapter 1", "Patched", 1)
+	if _, _, _, err = b2.AddPage("a.xhtml", "application/xhtml+xml", strings.NewReader(patched), "", &epub30.EPubOptions{TOCItemTitle: "A2"}); err != nil {
+		t.Fatal(err)
+	}
+	gen, _ = epub30.NewIndexGenerator("TOC")
+	if _, err = b2.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err = ugarit.NewReader(bytes.NewReader(buf2.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range br.Spine() {
+		n++
+	}
+	if n != spine {
+		t.Errorf("spine: got %d itemrefs, want %d", n, spine)
+	}
+	toc := br.TOC().Children
+	if len(toc) != 2 || toc[0].Title != "A2" || toc[1].Title != "B" {
+		t.Errorf("TOC: got %v", toc)
+	}
+	if !strings.Contains(string(testutil.ZipEntry(t, buf2.Bytes(), "a.xhtml")), "Patched") {
+		t.Errorf("a.xhtml not patched")
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var buf testutil.BufCloser
+
+	codes := func(findings []ugarit.Finding) map[string]int {
+		res := map[string]int{}
+		for _, f := range findings {
+			if f.Severity >= ugarit.SeverityError {
+				res[f.Code]++
+			}
+		}
+		return res
+	}
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("text/ch1.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	findings, err := b.Validate()
+	if err != nil {
+		t.Fatalf("Validate: %s", err)
+	}
+	if c := codes(findings); len(c) != 0 {
+		t.Errorf("generated book: got %v", findings)
+	}
+
+	// Validate does not make Close repeat dcterms:modified
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := codes(br.Validate()); len(c) != 0 {
+		t.Errorf("closed book: got %v", c)
+	}
+}
+
+func TestReproducibleBuild(t *testing.T) {
+	stamp := time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+
+	build := func(setTime bool) []byte {
+		var buf testutil.BufCloser
+
+		b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", epub30.Versioner{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if setTime {
+			b.SetBuildTime(stamp)
+		}
+		for _, p := range []string{"text/ch1.xhtml", "text/ch2.xhtml"} {
+			if _, _, _, err = b.AddPage(p, "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub30.EPubOptions{TOCItemTitle: p}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		gen, _ := epub30.NewIndexGenerator("TOC")
+		if _, err = b.AddTOC(gen, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err = b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	first := build(true)
+	time.Sleep(1100 * time.Millisecond)
+	if !bytes.Equal(first, build(true)) {
+		t.Errorf("builds with the same time differ")
+	}
+
+	opf := string(testutil.ZipEntry(t, first, "content.opf"))
+	for _, want := range []string{
+		`<meta property="dcterms:modified">2020-05-17T10:30:00Z</meta>`,
+		`<meta property="ibooks:version">20200517103000</meta>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("content.opf: %s missing in %s", want, opf)
+		}
+	}
+	zr, err := zip.NewReader(bytes.NewReader(first), int64(len(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if !f.Modified.Equal(stamp) {
+			t.Errorf("%s: modified %s", f.Name, f.Modified)
+		}
+	}
+
+	// SOURCE_DATE_EPOCH stamps the books not given a time
+	t.Setenv(ugarit.SourceDateEpoch, strconv.FormatInt(stamp.Unix(), 10))
+	if !bytes.Equal(first, build(false)) {
+		t.Errorf("SOURCE_DATE_EPOCH build differs")
+	}
+}
+
+// foreignTOC is a TOC entry not made by the book.
+type foreignTOC struct {
+	ugarit.TOCRef
+}
+
+func TestWriteErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "book.epub")
+	readErr := errors.New("read failed")
+
+	newBook := func(target io.WriteCloser) *epub30.Book {
+		b, err := epub30.New(target, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err = b.AddPage("text/ch1.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", nil); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	leftovers := func() {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if e.Name() != "book.epub" {
+				t.Errorf("temporary file left: %s", e.Name())
+			}
+		}
+	}
+
+	// A failed read makes the book fail fast and Close discard it
+	af, err := ugarit.CreateAtomic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBook(af)
+	src := io.MultiReader(strings.NewReader("<html>"), iotest.ErrReader(readErr))
+	if _, _, _, err = b.AddPage("text/ch2.xhtml", "application/xhtml+xml", src, "", nil); err != readErr {
+		t.Errorf("AddPage: got %v", err)
+	}
+	if _, _, err = b.AddFile("img/a.png", "image/png", strings.NewReader("PNG"), "", nil); err != readErr {
+		t.Errorf("AddFile after failure: got %v", err)
+	}
+	if _, err = b.Validate(); err != readErr {
+		t.Errorf("Validate after failure: got %v", err)
+	}
+	if err = b.Remove("text/ch1.xhtml"); err != readErr {
+		t.Errorf("Remove after failure: got %v", err)
+	}
+	if _, err = b.Open("text/ch1.xhtml"); err != readErr {
+		t.Errorf("Open after failure: got %v", err)
+	}
+	if _, err = b.AddIdentifier("urn:isbn:0-306-40615-2", nil); err != readErr {
+		t.Errorf("AddIdentifier after failure: got %v", err)
+	}
+	if err = b.SetRendition(nil); err != readErr {
+		t.Errorf("SetRendition after failure: got %v", err)
+	}
+	if b.Err() != readErr {
+		t.Errorf("Err: got %v", b.Err())
+	}
+	if err = b.Close(); err != readErr {
+		t.Errorf("Close after failure: got %v", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("failed book written: %v", err)
+	}
+	leftovers()
+
+	// Options failing AddPage leave the book as it was
+	b = newBook(&testutil.BufCloser{})
+	page := `<html xmlns="http://www.w3.org/1999/xhtml"><body><img src="a.png"/><img src="nothere.png"/></body></html>`
+	if _, _, _, err = b.AddPage("p.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub30.EPubOptions{Assets: fs.FS(fstest.MapFS{"a.png": {Data: []byte("PNG")}})}); err == nil {
+		t.Errorf("missing asset: no error")
+	}
+	if _, _, _, err = b.AddPage("p.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub30.EPubOptions{TOCItemTitle: "P", TOC: foreignTOC{}}); err != ugarit.ErrorInvalidOptionType {
+		t.Errorf("invalid TOC: got %v", err)
+	}
+	if files := b.AllFiles(); len(files) != 1 {
+		t.Errorf("files: got %v", files)
+	}
+	if err = b.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+
+	// Closing renames the complete book into place, with the mode os.Create
+	// gives a new file
+	af, err = ugarit.CreateAtomic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = newBook(af)
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := os.Create(filepath.Join(dir, "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Close()
+	rfi, _ := os.Stat(ref.Name())
+	os.Remove(ref.Name())
+	if fi, err := os.Stat(path); err != nil || fi.Mode() != rfi.Mode() {
+		t.Errorf("mode: got %v, want %v (%v)", fi.Mode(), rfi.Mode(), err)
+	}
+	if err = b.Close(); err != ugarit.ErrorBookClosed {
+		t.Errorf("second Close: got %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ugarit.NewReader(bytes.NewReader(data)); err != nil {
+		t.Errorf("NewReader: %s", err)
+	}
+	leftovers()
+
+	// Aborting keeps the previous book
+	af, err = ugarit.CreateAtomic(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = newBook(af)
+	if err = b.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = b.AddFile("img/a.png", "image/png", strings.NewReader("PNG"), "", nil); err != ugarit.ErrorAborted {
+		t.Errorf("AddFile after Abort: got %v", err)
+	}
+	if err = b.Close(); err != ugarit.ErrorAborted {
+		t.Errorf("Close after Abort: got %v", err)
+	}
+	if err = b.RemoveAll("text"); err != ugarit.ErrorAborted {
+		t.Errorf("RemoveAll after Abort: got %v", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Errorf("Abort changed the previous book")
+	}
+	leftovers()
+
+	// Write errors are reported by Close
+	if err = newBook(testutil.FailWriter{}).Close(); err == nil {
+		t.Errorf("Close: no write error")
+	}
+}
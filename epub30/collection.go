@@ -0,0 +1,40 @@
+package epub30
+
+import (
+   "github.com/luisfurquim/ugarit"
+)
+
+// AddCollection declares a series or set the book belongs to, as a
+// belongs-to-collection meta refined by its collection-type and
+// group-position. A book may belong to several collections.
+// It returns the meta id, generated if c has none.
+func (b *Book) AddCollection(c ugarit.Collection) (string, error) {
+   var err error
+
+   if b.err != nil {
+      return "", b.err
+   }
+
+   err = c.Check()
+   if err != nil {
+      return "", err
+   }
+
+   if c.ID == "" {
+      c.ID = b.newMetaID("collection")
+   }
+
+   b.Package.Metadata.Metatag = append(b.Package.Metadata.Metatag, Metatag{
+      ID:       c.ID,
+      Property: "belongs-to-collection",
+      Data:     c.Name,
+   })
+   if c.Type != "" {
+      b.AddRefinement(c.ID, "collection-type", c.Type, "")
+   }
+   if c.Position != "" {
+      b.AddRefinement(c.ID, "group-position", c.Position, "")
+   }
+
+   return c.ID, nil
+}
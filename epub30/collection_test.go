@@ -0,0 +1,58 @@
+package epub30_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestCollections(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []ugarit.Collection{
+		{Name: "The Trilogy", Type: "series", Position: "2"},
+		{Name: "Box Set", Type: "set"},
+	} {
+		if _, err = b.AddCollection(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []ugarit.Collection{{}, {Name: "X", Type: "shelf"}, {Name: "X", Position: "second"}} {
+		if _, err = b.AddCollection(c); err != ugarit.ErrorInvalidCollection {
+			t.Errorf("%+v: got %v", c, err)
+		}
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opf := string(testutil.ZipEntry(t, buf.Bytes(), "content.opf"))
+	if want := `<meta id="collection1" property="belongs-to-collection">The Trilogy</meta><meta refines="#collection1" property="collection-type">series</meta><meta refines="#collection1" property="group-position">2</meta>`; !strings.Contains(opf, want) {
+		t.Errorf("content.opf: %s missing in %s", want, opf)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+	want := []ugarit.Collection{
+		{ID: "collection1", Name: "The Trilogy", Type: "series", Position: "2"},
+		{ID: "collection2", Name: "Box Set", Type: "set"},
+	}
+	if got := br.Metadata().Collections; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("collections: got %+v", got)
+	}
+}
@@ -2,9 +2,11 @@ package epub30
 
 import (
    "io"
+   "time"
+   "bytes"
    "errors"
    "regexp"
-   "archive/zip"
+   "encoding/xml"
    "golang.org/x/net/html"
    "github.com/luisfurquim/ugarit"
    "github.com/PuerkitoBio/goquery"
@@ -27,6 +29,61 @@ type EPubOptions struct {
    MarginRight  int
    MarginTop    int
    MarginBottom int
+   Assets       interface{} // fs.FS or AssetFetch: AddPage adds the local resources the page references
+   Rendition    *Rendition  // AddPage: fixed-layout overrides and page spread of the page
+   Headings     *ugarit.HeadingOptions // AddPage: nests TOC entries of the page headings under the page entry
+   Landmark     string      // AddPage: semantic role of the page (titlepage, bodymatter, index...), see ugarit.LandmarkRole
+   LandmarkTitle string     // AddPage: label of the landmark; ugarit.LandmarkLabel of the role if empty
+}
+
+// Rendition holds the fixed-layout settings (the rendition:* properties) of
+// the whole book (New, SetRendition) or of a single page (EPubOptions).
+// Empty fields are left to the reading system or, for pages, to the book
+// settings.
+type Rendition struct {
+   Layout      string // LayoutPrePaginated (fixed layout) or LayoutReflowable
+   Orientation string // "auto", "landscape" or "portrait"
+   Spread      string // "auto", "none", "landscape" or "both": when to show two pages side by side
+   Flow        string // "auto", "paginated", "scrolled-continuous" or "scrolled-doc"
+   PageSpread  string // pages only: "left", "right" or "center"
+
+   // Viewport of the fixed-layout XHTML pages, injected by AddPage into
+   // those not setting it (see EPubOptions.Width and Height)
+   Width  int
+   Height int
+}
+
+// AssetFetch returns the contents of the file at path, relative to the
+// root folder, for the Assets option of EPubOptions.
+type AssetFetch func(path string) (io.ReadCloser, error)
+
+// Clip synchronizes an element of a page with a segment of its audio, for
+// AddMediaOverlay.
+type Clip struct {
+   ID        string        // id of the page element
+   ClipBegin time.Duration // offset of the segment in the audio file
+   ClipEnd   time.Duration
+}
+
+// MediaOverlayOptions configures AddMediaOverlay.
+type MediaOverlayOptions struct {
+   Path                string // of the SMIL file; defaults to the page path with the .smil extension
+   ID                  string // manifest id of the SMIL file
+   ActiveClass         string // media:active-class, shared by the whole book
+   PlaybackActiveClass string // media:playback-active-class, shared by the whole book
+}
+
+// Accessibility holds the schema.org accessibility metadata of the book and
+// the accessibility standard it conforms to, for SetAccessibility (or New).
+// See https://www.w3.org/TR/epub-a11y-11/ for the values.
+type Accessibility struct {
+   AccessMode           []string // textual, visual, auditory...
+   AccessModeSufficient []string // sets of access modes enough to read the book, e.g. "textual" or "textual,visual"
+   Feature              []string // accessibilityFeature: alternativeText, tableOfContents, pageNavigation...
+   Hazard               []string // accessibilityHazard: none, noFlashingHazard, sound...
+   Summary              string   // accessibilitySummary, in plain words
+   ConformsTo           string   // dcterms:conformsTo, e.g. ConformsToEPUBA11y11WCAG21AA
+   CertifiedBy          string   // a11y:certifiedBy, the party which evaluated the conformance
 }
 
 type IndexOptions struct {
@@ -42,6 +99,8 @@ type TOCContent struct {
    index      TOC
    ref        string
    subSection ugarit.SectionStyle
+   fragment   string // appended to the page href, for entries pointing inside a page
+   number     string // section number set by AddTOC, prepended to the label
 }
 
 type TOC []*TOCContent
@@ -50,14 +109,44 @@ type TOC []*TOCContent
 type Book struct {
    Package    Package `xml:"package"`
    cwd        string
-   zfd        *zip.Writer
    fd         io.WriteCloser
    fid        int
    index      TOC
    subSection ugarit.SectionStyle
+   numbered   bool // set by NumberHeadings; AddTOC writes the section numbers into the page headings
    RootFolder string
    ManifIndex map[string]string `xml:"-"`
    coverPath  string // set by AddCover; AddTOC uses it for the cover landmark
+   src        ugarit.BookReader // set by Open; source of the loaded files
+   files      map[string]*file  // book files kept until Close, by href
+   rendition  Rendition         // book fixed-layout settings
+   pages      []pageBreak       // set by AddPageBreak; AddTOC lists them in the page list
+   landmarks  []landmark        // set by AddPage; AddTOC lists them in the landmarks nav
+   buildTime  time.Time         // set by SetBuildTime; ugarit.BuildTime() if zero
+   err        error             // sticky error, see Err; set by Close and Abort too
+   clockVersion bool            // the version comes from a Versioner, SetBuildTime updates it
+}
+
+// landmark is a page with a semantic role, set by the EPubOptions Landmark.
+type landmark struct {
+   href  string // manifest href of the page
+   role  string // epub:type of the page
+   label string
+}
+
+// pageBreak is a print page break registered by AddPageBreak.
+type pageBreak struct {
+   label string
+   href  string // manifest href of the file the page starts in
+   id    string // fragment id of the page start, if any
+}
+
+// file is the content of a book file, either staged in memory or still in
+// the book Open loaded it from.
+type file struct {
+   data   *bytes.Buffer
+   loaded string // path in the source book, if data is nil
+   obfuscation string // font obfuscation algorithm applied when saved, see AddFont
 }
 
 //Package content.opf
@@ -86,23 +175,56 @@ type Metadata struct {
    Publisher  []string     `xml:"dc:publisher"`
    Date       []Date       `xml:"dc:date"`
    Signature  *Signature   `xml:"link,omitempty"`
+   DC         []DCElement
    Metatag    []Metatag    `xml:"meta"`
 }
 
+// DCElement is any Dublin Core element without a dedicated Metadata field
+// (dc:subject, dc:description...), or one needing attributes the dedicated
+// field can't hold. XMLName holds the prefixed name, e.g. "dc:subject".
+type DCElement struct {
+   XMLName  xml.Name
+   ID       string `xml:"id,attr,omitempty"`
+   Langattr string `xml:"xml:lang,attr,omitempty"`
+   Dir      string `xml:"dir,attr,omitempty"`
+   Data     string `xml:",chardata"`
+}
+
 // Identifier
+// EPUB 3 has no scheme attribute: AddIdentifier writes Scheme as an
+// identifier-type refines meta instead.
 type Identifier struct {
    Data   string `xml:",chardata"`
    ID     string `xml:"id,attr,omitempty"`
-   Scheme string `xml:"scheme,attr,omitempty"`
+   Scheme string `xml:"-"`
 }
 
 // Author
+// EPUB 3 has no role and file-as attributes: New writes Role and FileAs as
+// refines metas instead (see DCOptions).
 type Author struct {
-   Role   string `xml:"role,attr,omitempty"`
-   FileAs string `xml:"file-as,attr,omitempty"`
+   ID     string `xml:"id,attr,omitempty"`
+   Role   string `xml:"-"`
+   FileAs string `xml:"-"`
    Data   string `xml:",chardata"`
 }
 
+// DCOptions holds the attributes and refinements of a Dublin Core element
+// added by AddDC. Each refinement is written as a meta refining the element
+// id.
+type DCOptions struct {
+   ID                  string // element id; generated if empty
+   Lang                string // xml:lang of the element
+   Dir                 string // text direction of the element, "ltr" or "rtl"
+   Role                string // MARC relator code (aut, edt, ill, trl...), for creators and contributors
+   FileAs              string // sort form, e.g. "Doe, Jane"
+   AlternateScript     string // the value in another script, e.g. a Japanese name in Latin script
+   AlternateScriptLang string // language of AlternateScript
+   TitleType           string // main, subtitle, short, collection, edition or expanded, for titles
+   DisplaySeq          int    // display order among the elements of the same kind, from 1
+   IdentifierType      string // for identifiers; an ONIX code list 5 number (15 for ISBN-13) or a scheme name
+}
+
 // Date
 type Date struct {
    Event string `xml:"event,attr,omitempty"`
@@ -119,7 +241,10 @@ type Signature struct {
 type Metatag struct {
    Name     string `xml:"name,attr,omitempty"`
    Langattr string `xml:"xml:lang,attr,omitempty"`
+   ID       string `xml:"id,attr,omitempty"`
+   Refines  string `xml:"refines,attr,omitempty"`
    Property string `xml:"property,attr,omitempty"`
+   Scheme   string `xml:"scheme,attr,omitempty"`
    Content  string `xml:"content,attr,omitempty"`
    Data     string `xml:",chardata"`
 }
@@ -150,6 +275,36 @@ type SpineItem struct {
    Properties string `xml:"properties,attr,omitempty"`
 }
 
+// smil is a media overlay document
+type smil struct {
+   XMLName   struct{} `xml:"smil"`
+   Xmlns     string   `xml:"xmlns,attr"`
+   XmlnsEpub string   `xml:"xmlns:epub,attr"`
+   Version   string   `xml:"version,attr"`
+   Body      smilBody `xml:"body"`
+}
+
+type smilBody struct {
+   Textref string    `xml:"epub:textref,attr,omitempty"`
+   Par     []smilPar `xml:"par"`
+}
+
+type smilPar struct {
+   ID    string    `xml:"id,attr"`
+   Text  smilText  `xml:"text"`
+   Audio smilAudio `xml:"audio"`
+}
+
+type smilText struct {
+   Src string `xml:"src,attr"`
+}
+
+type smilAudio struct {
+   Src       string `xml:"src,attr"`
+   ClipBegin string `xml:"clipBegin,attr"`
+   ClipEnd   string `xml:"clipEnd,attr"`
+}
+
 type Guide struct {
    Reference []Reference `xml:"reference,omitempty"`
 }
@@ -172,7 +327,11 @@ type Store struct {
    w io.Writer
 }
 
-type Versioner struct{}
+// Versioner makes versions out of the build time: Time if set, else
+// ugarit.BuildTime().
+type Versioner struct {
+   Time time.Time
+}
 
 const (
    prop_Min int = iota
@@ -187,6 +346,22 @@ const (
    prop_Nav        // nav
 )
 
+// EPUB Accessibility 1.1 conformance identifiers, for Accessibility.ConformsTo
+const (
+   ConformsToEPUBA11y11WCAG20A  = "EPUB Accessibility 1.1 - WCAG 2.0 Level A"
+   ConformsToEPUBA11y11WCAG20AA = "EPUB Accessibility 1.1 - WCAG 2.0 Level AA"
+   ConformsToEPUBA11y11WCAG21A  = "EPUB Accessibility 1.1 - WCAG 2.1 Level A"
+   ConformsToEPUBA11y11WCAG21AA = "EPUB Accessibility 1.1 - WCAG 2.1 Level AA"
+   ConformsToEPUBA11y11WCAG22A  = "EPUB Accessibility 1.1 - WCAG 2.2 Level A"
+   ConformsToEPUBA11y11WCAG22AA = "EPUB Accessibility 1.1 - WCAG 2.2 Level AA"
+)
+
+// Rendition layouts
+const (
+   LayoutPrePaginated = "pre-paginated"
+   LayoutReflowable   = "reflowable"
+)
+
 var prop []string = []string{"", "mathml", "scripted", "svg", "", "remote-resources", "cover-image", "nav"}
 
 var chfilter map[rune]rune
@@ -195,4 +370,7 @@ var ASCDigitDash *regexp.Regexp
 var hasProto *regexp.Regexp
 
 var ErrorMustAddItemToStartNewSection error = errors.New("Must add item to start new section")
+var ErrorInvalidClip error = errors.New("Invalid media overlay clip")
+var ErrorInvalidRendition error = errors.New("Invalid rendition property value")
 
+var ErrorInvalidDCElement error = errors.New("Invalid Dublin Core element")
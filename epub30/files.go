@@ -0,0 +1,287 @@
+package epub30
+
+import (
+   "io"
+   "io/fs"
+   "bytes"
+   "strings"
+   "github.com/luisfurquim/ugarit"
+)
+
+// Files are staged in memory (or left in the book Open loaded them from)
+// and only stored in the archive by Close, so they can still be removed,
+// renamed or read back until then. Paths are relative to the root folder,
+// a leading '/' being ignored, just like in AddFile.
+
+// Remove removes the file at path from the book, along with its spine and
+// guide references. TOC entries pointing to it are dropped, their children
+// taking their place.
+func (b *Book) Remove(path string) error {
+   if b.err != nil {
+      return b.err
+   }
+
+   return ugarit.RemoveFile(manifest{b}, path)
+}
+
+// RemoveAll removes path and any files under it. If the path does not
+// exist, RemoveAll returns nil (no error).
+func (b *Book) RemoveAll(path string) error {
+   if b.err != nil {
+      return b.err
+   }
+
+   return ugarit.RemoveAllFiles(manifest{b}, path)
+}
+
+// Rename renames (moves) oldpath to newpath. If oldpath is a folder, every
+// file under it is moved. Manifest, guide and TOC entries follow the files.
+// References inside the book contents are not rewritten, so call it before
+// adding the pages linking to the files or AddTOC.
+func (b *Book) Rename(oldpath, newpath string) error {
+   if b.err != nil {
+      return b.err
+   }
+
+   return ugarit.RenameFile(manifest{b}, oldpath, newpath)
+}
+
+// Open opens the file at path for reading its current contents.
+func (b *Book) Open(path string) (io.Reader, error) {
+   var n int
+   var f *file
+   var ok bool
+
+   if b.err != nil {
+      return nil, b.err
+   }
+
+   n = b.lookup(path)
+   if n < 0 {
+      return nil, ugarit.ErrorFileNotFound
+   }
+
+   // Files registered by AddReference have no contents
+   f, ok = b.files[b.Package.Manifest[n].Href]
+   if !ok {
+      return nil, ugarit.ErrorFileNotFound
+   }
+
+   if f.data != nil {
+      return bytes.NewReader(f.data.Bytes()), nil
+   }
+
+   return b.src.DocReader(f.loaded)
+}
+
+// AllFiles lists the pathnames of the files stored in the book, in manifest
+// order. They are absolute, i.e., relative to the root folder and with a
+// leading '/'.
+func (b *Book) AllFiles() []string {
+   var files []string
+
+   files = make([]string, 0, len(b.files))
+   for _, m := range b.Package.Manifest {
+      if _, ok := b.files[m.Href]; ok {
+         files = append(files, "/" + relPath(m.Href))
+      }
+   }
+
+   return files
+}
+
+// AddFS adds to the book every file under root in fsys, detecting their
+// media types, as listed by ugarit.ScanFS. Options, if not nil, must be an
+// *ugarit.ImportOptions, selecting the files which become spine pages and
+// whether they figure in the TOC. Files already in the book are replaced.
+func (b *Book) AddFS(fsys fs.FS, root string, options interface{}) error {
+   var opt *ugarit.ImportOptions
+
+   if options != nil {
+      switch options.(type) {
+      case *ugarit.ImportOptions:
+         opt = options.(*ugarit.ImportOptions)
+      default:
+         return ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   return ugarit.AddFS(b, fsys, root, opt, func(title string) interface{} {
+      if title == "" {
+         return nil
+      }
+      return &EPubOptions{TOCItemTitle: title}
+   })
+}
+
+// relPath returns path relative to the root folder, as manifest hrefs are.
+func relPath(path string) string {
+   return ugarit.RelPath(path)
+}
+
+// lookup returns the manifest position of the file at path, or -1.
+func (b *Book) lookup(path string) int {
+   return ugarit.LookupFile(manifest{b}, path)
+}
+
+// manifest is the ugarit.Manifest view of the book the file operations
+// work on.
+type manifest struct {
+   b *Book
+}
+
+func (m manifest) Len() int {
+   return len(m.b.Package.Manifest)
+}
+
+func (m manifest) Href(n int) string {
+   return m.b.Package.Manifest[n].Href
+}
+
+func (m manifest) RenameItem(n int, href string) {
+   m.b.renameItem(n, href)
+}
+
+func (m manifest) RemoveItem(n int) {
+   m.b.removeItem(n)
+}
+
+// renameItem changes the href of the Nth manifest item, updating the
+// references to it.
+func (b *Book) renameItem(n int, href string) {
+   var old string
+   var parts []string
+
+   old = b.Package.Manifest[n].Href
+   b.Package.Manifest[n].Href = href
+
+   if id, ok := b.ManifIndex[old]; ok {
+      delete(b.ManifIndex, old)
+      b.ManifIndex[href] = id
+   }
+
+   if f, ok := b.files[old]; ok {
+      delete(b.files, old)
+      b.files[href] = f
+   }
+
+   for i, ref := range b.Package.Guide.Reference {
+      parts = strings.SplitN(ref.Href, "#", 2)
+      if parts[0] == old {
+         parts[0] = href
+         b.Package.Guide.Reference[i].Href = strings.Join(parts, "#")
+      }
+   }
+
+   if b.coverPath == old {
+      b.coverPath = href
+   }
+
+   for i := range b.pages {
+      if b.pages[i].href == old {
+         b.pages[i].href = href
+      }
+   }
+
+   for i := range b.landmarks {
+      if b.landmarks[i].href == old {
+         b.landmarks[i].href = href
+      }
+   }
+}
+
+// removeItem removes the Nth manifest item along with its contents, its
+// spine and guide references, its page breaks and landmarks, the cover
+// metadata naming it and, for media overlays, the media-overlay links and
+// durations, keeping the TOC entries pointing to the following items valid.
+func (b *Book) removeItem(n int) {
+   var m Manifest
+   var spine []SpineItem
+   var guide []Reference
+   var pages []pageBreak
+   var lmarks []landmark
+
+   m = b.Package.Manifest[n]
+   b.Package.Manifest = append(b.Package.Manifest[:n], b.Package.Manifest[n+1:]...)
+   delete(b.ManifIndex, m.Href)
+   delete(b.files, m.Href)
+
+   for _, si := range b.Package.Spine.Itemref {
+      if si.IDref != m.ID {
+         spine = append(spine, si)
+      }
+   }
+   b.Package.Spine.Itemref = spine
+
+   if b.Package.Spine.Toc == m.ID {
+      b.Package.Spine.Toc = ""
+   }
+
+   for _, ref := range b.Package.Guide.Reference {
+      if strings.SplitN(ref.Href, "#", 2)[0] != m.Href {
+         guide = append(guide, ref)
+      }
+   }
+   b.Package.Guide.Reference = guide
+
+   if b.coverPath == m.Href {
+      b.coverPath = ""
+   }
+
+   pages = b.pages[:0]
+   for _, pb := range b.pages {
+      if pb.href != m.Href {
+         pages = append(pages, pb)
+      }
+   }
+   b.pages = pages
+
+   lmarks = b.landmarks[:0]
+   for _, lm := range b.landmarks {
+      if lm.href != m.Href {
+         lmarks = append(lmarks, lm)
+      }
+   }
+   b.landmarks = lmarks
+
+   b.dropMeta(func(mt Metatag) bool {
+      return mt.Name == "cover" && mt.Content == m.ID
+   })
+
+   // A removed media overlay takes its duration away from the book
+   if m.MediaType == "application/smil+xml" {
+      for i := range b.Package.Manifest {
+         if b.Package.Manifest[i].MediaOverlay == m.ID {
+            b.Package.Manifest[i].MediaOverlay = ""
+         }
+      }
+      b.dropMeta(func(mt Metatag) bool {
+         return mt.Refines == "#" + m.ID
+      })
+      b.setDuration()
+   }
+
+   b.index = b.index.removeItem(n)
+}
+
+// removeItem drops the entries pointing to the Nth manifest item and
+// renumbers the entries pointing after it. Children of dropped entries
+// take their place.
+func (toc TOC) removeItem(n int) TOC {
+   var res TOC
+
+   res = make(TOC, 0, len(toc))
+   for _, tc := range toc {
+      tc.index = tc.index.removeItem(n)
+      switch {
+      case tc.ndx == n:
+         res = append(res, tc.index...)
+         continue
+      case tc.ndx > n:
+         tc.ndx--
+      }
+      res = append(res, tc)
+   }
+
+   return res
+}
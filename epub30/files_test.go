@@ -0,0 +1,154 @@
+package epub30_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestBookFiles(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, _ := epub30.NewIndexGenerator("TOC")
+
+	for _, p := range []string{"text/ch1.xhtml", "text/ch2.xhtml", "text/ch3.xhtml"} {
+		if _, _, _, err = b.AddPage(p, "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub30.EPubOptions{TOCItemTitle: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, w, err := b.AddFile("img/a.png", "image/png", nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = b.Rename("/text/ch1.xhtml", "one.xhtml"); err != nil {
+		t.Errorf("Rename: %s", err)
+	}
+	if err = b.Rename("img", "images"); err != nil {
+		t.Errorf("Rename folder: %s", err)
+	}
+	if err = b.Rename("text/ch2.xhtml", "text/ch3.xhtml"); err != ugarit.ErrorFileExists {
+		t.Errorf("Rename over existing file: got %v", err)
+	}
+	if err = b.Remove("text/ch2.xhtml"); err != nil {
+		t.Errorf("Remove: %s", err)
+	}
+	if err = b.Remove("text/ch2.xhtml"); err != ugarit.ErrorFileNotFound {
+		t.Errorf("Remove twice: got %v", err)
+	}
+	if err = b.RemoveAll("nothing/here"); err != nil {
+		t.Errorf("RemoveAll: %s", err)
+	}
+
+	// Writers stay valid until Close
+	w.Write([]byte("PNG"))
+	r, err := b.Open("images/a.png")
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "PNG" {
+		t.Errorf("Open: got %q", data)
+	}
+
+	if got := strings.Join(b.AllFiles(), " "); got != "/one.xhtml /text/ch3.xhtml /images/a.png" {
+		t.Errorf("AllFiles: got %q", got)
+	}
+
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	var paths []string
+	for _, it := range br.Spine() {
+		paths = append(paths, it.Doc.Path)
+	}
+	if got := strings.Join(paths, " "); !strings.HasSuffix(got, "one.xhtml text/ch3.xhtml") {
+		t.Errorf("spine: got %q", got)
+	}
+	toc := br.TOC()
+	if len(toc.Children) != 2 || toc.Children[0].Href != "one.xhtml" || toc.Children[1].Title != "text/ch3.xhtml" {
+		t.Errorf("TOC: got %+v", toc.Children)
+	}
+	if _, err = br.DocReader("images/a.png"); err != nil {
+		t.Errorf("renamed file: %s", err)
+	}
+}
+
+func TestAddFS(t *testing.T) {
+	var buf testutil.BufCloser
+	var pages, titles []string
+
+	site := fstest.MapFS{
+		"site/chapters/ch1.html":  {Data: []byte(`<html><head><title>One</title></head><body><p>1</p></body></html>`)},
+		"site/chapters/ch2.xhtml": {Data: []byte(`<html><body><h2>Two</h2></body></html>`)},
+		"site/css/style.css":      {Data: []byte("p{}")},
+		"site/img/a.png":          {Data: []byte("PNG")},
+		"site/img/noext":          {Data: []byte("\x89PNG\r\n\x1a\n....")},
+		"site/.DS_Store":          {Data: []byte("x")},
+	}
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddFS(site, "site", &ugarit.ImportOptions{TOC: true, Prefix: "web"}); err != nil {
+		t.Fatalf("AddFS: %s", err)
+	}
+	gen, _ := epub30.NewIndexGenerator("TOC")
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	for _, it := range br.Spine() {
+		if strings.HasPrefix(it.Doc.Path, "web/") {
+			pages = append(pages, it.Doc.Path)
+		}
+	}
+	if got := strings.Join(pages, " "); got != "web/chapters/ch1.html web/chapters/ch2.xhtml" {
+		t.Errorf("spine: got %q", got)
+	}
+	for _, n := range br.TOC().Children {
+		titles = append(titles, n.Title)
+	}
+	if got := strings.Join(titles, " "); got != "One Two" {
+		t.Errorf("TOC: got %q", got)
+	}
+
+	for p, mt := range map[string]string{
+		"web/chapters/ch1.html": "application/xhtml+xml",
+		"web/css/style.css":     "text/css",
+		"web/img/a.png":         "image/png",
+		"web/img/noext":         "image/png",
+	} {
+		if dm, ok := br.ItemByPath(p); !ok || dm.MimeType != mt {
+			t.Errorf("%s: got %+v", p, dm)
+		}
+	}
+	if _, ok := br.ItemByPath("web/.DS_Store"); ok {
+		t.Errorf("hidden file imported")
+	}
+}
@@ -0,0 +1,120 @@
+package epub30_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestFonts(t *testing.T) {
+	var buf, buf2 testutil.BufCloser
+
+	font := make([]byte, 2000)
+	for i := range font {
+		font[i] = byte(i * 7)
+	}
+	uid := "urn:isbn:9780306406157"
+	uuid := "urn:uuid:0a1b2c3d-4e5f-4061-8293-a4b5c6d7e8f9"
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{uid, uuid}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct {
+		path string
+		opt  interface{}
+	}{
+		{"fonts/a.otf", &ugarit.FontOptions{Obfuscation: ugarit.ObfuscationIDPF}},
+		{"fonts/b.woff", &ugarit.FontOptions{Obfuscation: ugarit.ObfuscationAdobe}},
+		{"fonts/c.ttf", nil},
+	} {
+		if _, _, err = b.AddFont(f.path, bytes.NewReader(font), "", f.opt); err != nil {
+			t.Fatalf("AddFont %s: %s", f.path, err)
+		}
+	}
+	if _, _, err = b.AddFont("fonts/d.txt", bytes.NewReader(font), "", nil); err != ugarit.ErrorUnknownFontType {
+		t.Errorf("unknown font type: got %v", err)
+	}
+	if _, _, err = b.AddFont("fonts/d.otf", bytes.NewReader(font), "", &ugarit.FontOptions{Obfuscation: "rot13"}); err != ugarit.ErrorUnknownObfuscation {
+		t.Errorf("unknown obfuscation: got %v", err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// IDPF: SHA-1 of the unique identifier over the first 1040 bytes
+	key := sha1.Sum([]byte(uid))
+	stored := testutil.ZipEntry(t, buf.Bytes(), "fonts/a.otf")
+	for i := range font {
+		want := font[i]
+		if i < 1040 {
+			want ^= key[i%len(key)]
+		}
+		if stored[i] != want {
+			t.Fatalf("a.otf byte %d: got %x, want %x", i, stored[i], want)
+		}
+	}
+	// Adobe: the UUID bytes over the first 1024 bytes
+	uuidKey, _ := hex.DecodeString("0a1b2c3d4e5f40618293a4b5c6d7e8f9")
+	stored = testutil.ZipEntry(t, buf.Bytes(), "fonts/b.woff")
+	if stored[17] != font[17]^uuidKey[1] || stored[1023] != font[1023]^uuidKey[15] || stored[1024] != font[1024] {
+		t.Errorf("b.woff not obfuscated with the UUID")
+	}
+	if !bytes.Equal(testutil.ZipEntry(t, buf.Bytes(), "fonts/c.ttf"), font) {
+		t.Errorf("c.ttf obfuscated")
+	}
+	enc := string(testutil.ZipEntry(t, buf.Bytes(), "META-INF/encryption.xml"))
+	if strings.Count(enc, "<enc:EncryptedData>") != 2 || !strings.Contains(enc, `<enc:EncryptionMethod Algorithm="http://www.idpf.org/2008/embedding"/><enc:CipherData><enc:CipherReference URI="`) {
+		t.Errorf("encryption.xml: got %s", enc)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+	for path, want := range map[string]string{
+		"fonts/a.otf":  "font/otf " + ugarit.ObfuscationIDPF,
+		"fonts/b.woff": "font/woff " + ugarit.ObfuscationAdobe,
+		"fonts/c.ttf":  "font/ttf ",
+	} {
+		dm, ok := br.ItemByPath(path)
+		if got := dm.MimeType + " " + dm.Obfuscation; !ok || got != want {
+			t.Errorf("%s: got %q, want %q", path, got, want)
+		}
+		r, err := br.DocReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := io.ReadAll(r); !bytes.Equal(data, font) {
+			t.Errorf("%s: not de-obfuscated", path)
+		}
+	}
+	if data, err := fs.ReadFile(br.FS(true), "fonts/b.woff"); err != nil || !bytes.Equal(data, font) {
+		t.Errorf("FS: not de-obfuscated (%v)", err)
+	}
+
+	// Editing keeps the fonts obfuscated
+	b2, err := epub30.Open(br, &buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(testutil.ZipEntry(t, buf2.Bytes(), "fonts/a.otf"), testutil.ZipEntry(t, buf.Bytes(), "fonts/a.otf")) {
+		t.Errorf("reopened a.otf: obfuscation lost")
+	}
+}
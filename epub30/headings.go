@@ -0,0 +1,34 @@
+package epub30
+
+import (
+   "github.com/luisfurquim/ugarit"
+)
+
+// addHeadings nests the TOC entries of the page headings found by
+// ugarit.ScanHeadings under the page entry, as ugarit.NestHeadings nests
+// them.
+func addHeadings(entry *TOCContent, heads []ugarit.Heading, opt *ugarit.HeadingOptions) {
+   if opt == nil || len(heads) == 0 {
+      return
+   }
+
+   entry.index = append(entry.index, headingEntries(entry.ndx, ugarit.NestHeadings(heads, opt.Depth))...)
+}
+
+// headingEntries returns the TOC entries of the headings, pointing inside
+// the Nth manifest item.
+func headingEntries(n int, nodes []*ugarit.HeadingNode) TOC {
+   var toc TOC
+
+   toc = make(TOC, 0, len(nodes))
+   for _, node := range nodes {
+      toc = append(toc, &TOCContent{
+         ndx:      n,
+         Title:    node.Title,
+         index:    headingEntries(n, node.Children),
+         fragment: node.ID,
+      })
+   }
+
+   return toc
+}
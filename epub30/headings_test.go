@@ -0,0 +1,83 @@
+package epub30_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestTOCHeadings(t *testing.T) {
+	var buf testutil.BufCloser
+
+	page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title></head><body>
+<h1>Chapter</h1>
+<h2>First <em>part</em></h2><p>a</p>
+<h3 id="heading1">Detail</h3>
+<h4>Too deep</h4>
+<h2 class="x">Second</h2>
+<h2></h2>
+<p class="sec" aria-level="2">Aside</p>
+</body></html>`
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("ch.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub30.EPubOptions{TOCItemTitle: "Chapter", Headings: &ugarit.HeadingOptions{Depth: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("bad.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub30.EPubOptions{TOCItemTitle: "Bad", Headings: &ugarit.HeadingOptions{Selector: "h2["}}); err == nil {
+		t.Error("invalid selector accepted")
+	}
+	gen, _ := epub30.NewIndexGenerator()
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+
+	var titles, hrefs []string
+	var walk func(toc []*ugarit.TOCNode, depth int)
+	walk = func(toc []*ugarit.TOCNode, depth int) {
+		for _, e := range toc {
+			titles = append(titles, strings.Repeat("-", depth)+e.Title)
+			hrefs = append(hrefs, e.Href)
+			walk(e.Children, depth+1)
+		}
+	}
+	walk(br.TOC().Children, 0)
+	if got, want := strings.Join(titles, "|"), "Chapter|-First part|--Detail|-Second"; got != want {
+		t.Errorf("titles: got %q, want %q", got, want)
+	}
+	if got, want := strings.Join(hrefs, " "), "ch.xhtml ch.xhtml#heading3 ch.xhtml#heading1 ch.xhtml#heading5"; got != want {
+		t.Errorf("hrefs: got %q, want %q", got, want)
+	}
+
+	r, err := br.DocReader("ch.xhtml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	for _, want := range []string{`<h1 id="heading2">Chapter</h1>`, `<h2 id="heading3">First`, `<h4 id="heading4">`, `<h2 id="heading5" class="x">Second</h2>`, `<h2></h2>`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("ch.xhtml: %s missing in %s", want, data)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package epub30
+
+import (
+   "strconv"
+   "strings"
+   "github.com/luisfurquim/ugarit"
+)
+
+// AddIdentifier adds an identifier to the book metadata. Options, if not
+// nil, must be a *ugarit.IdentifierOptions. ISBNs and UUIDs are checked and
+// written in their urn:isbn: and urn:uuid: forms (see
+// ugarit.NormalizeIdentifier). The scheme is written as an identifier-type
+// refinement: ISBNs get the ONIX code list 5 number 15 (ISBN-13) or 02
+// (ISBN-10), as do other numeric schemes.
+// It returns the identifier id; an id given in the options must not be in
+// use yet (ugarit.ErrorDuplicateID).
+func (b *Book) AddIdentifier(value string, options interface{}) (string, error) {
+   var opt *ugarit.IdentifierOptions
+   var scheme string
+   var err error
+
+   if b.err != nil {
+      return "", b.err
+   }
+
+   opt = &ugarit.IdentifierOptions{}
+   if options != nil {
+      switch options.(type) {
+      case *ugarit.IdentifierOptions:
+         opt = options.(*ugarit.IdentifierOptions)
+      default:
+         return "", ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   value, scheme, err = ugarit.NormalizeIdentifier(value, opt.Scheme)
+   if err != nil {
+      return "", err
+   }
+
+   id := opt.ID
+   if id == "" {
+      id = b.newMetaID("pub-id")
+   } else if b.usedIDs()[id] {
+      return "", ugarit.ErrorDuplicateID
+   }
+
+   b.Package.Metadata.Identifier = append(b.Package.Metadata.Identifier, Identifier{
+      Data:   value,
+      ID:     id,
+      Scheme: scheme,
+   })
+
+   if strings.ToUpper(scheme) == "ISBN" {
+      scheme = "15"
+      if len(value) == len("urn:isbn:") + 10 {
+         scheme = "02"
+      }
+   }
+   if _, err = strconv.Atoi(scheme); err == nil {
+      b.AddRefinement(id, "identifier-type", scheme, "onix:codelist5")
+   } else if scheme != "" {
+      b.AddRefinement(id, "identifier-type", scheme, "")
+   }
+
+   if opt.Unique {
+      b.Package.UID = id
+   }
+
+   return id, nil
+}
+
+// SetUniqueIdentifier makes the identifier with the given id the
+// unique-identifier of the package, the one font obfuscation keys on.
+func (b *Book) SetUniqueIdentifier(id string) error {
+   if b.err != nil {
+      return b.err
+   }
+
+   for _, ident := range b.Package.Metadata.Identifier {
+      if ident.ID == id {
+         b.Package.UID = id
+         return nil
+      }
+   }
+
+   return ugarit.ErrorUnknownIdentifier
+}
@@ -0,0 +1,66 @@
+package epub30_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestIdentifiers(t *testing.T) {
+	var buf testutil.BufCloser
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"a", "b"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	isbn, err := b.AddIdentifier("978-3-16-148410-0", &ugarit.IdentifierOptions{Scheme: "ISBN", Unique: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uuid, _ := ugarit.UUIDv5(ugarit.NamespaceURL, "http://example.com/book")
+	if _, err = b.AddIdentifier(uuid, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.AddIdentifier("978-3-16-148410-1", &ugarit.IdentifierOptions{Scheme: "ISBN"}); err != ugarit.ErrorInvalidISBN {
+		t.Errorf("invalid ISBN: got %v", err)
+	}
+	if _, err = b.AddIdentifier(uuid, &ugarit.IdentifierOptions{ID: isbn}); err != ugarit.ErrorDuplicateID {
+		t.Errorf("duplicate id: got %v", err)
+	}
+	if err = b.SetUniqueIdentifier("nope"); err != ugarit.ErrorUnknownIdentifier {
+		t.Errorf("SetUniqueIdentifier: got %v", err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opf := string(testutil.ZipEntry(t, buf.Bytes(), "content.opf"))
+	for _, want := range []string{
+		`unique-identifier="` + isbn + `"`,
+		`<dc:identifier id="pub-id">a</dc:identifier><dc:identifier id="pub-id1">b</dc:identifier>`,
+		`<dc:identifier id="` + isbn + `">urn:isbn:9783161484100</dc:identifier>`,
+		`<meta refines="#` + isbn + `" property="identifier-type" scheme="onix:codelist5">15</meta>`,
+		`property="identifier-type">UUID</meta>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("content.opf: %s missing in %s", want, opf)
+		}
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+	if id := br.Metadata().Identifier(); id.Value != "urn:isbn:9783161484100" || id.Scheme != "15" {
+		t.Errorf("unique identifier: got %+v", id)
+	}
+}
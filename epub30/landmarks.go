@@ -0,0 +1,41 @@
+package epub30
+
+import (
+   "github.com/luisfurquim/ugarit"
+)
+
+// setLandmark gives the Nth manifest item a semantic role (see
+// ugarit.LandmarkRole): AddTOC lists it in the landmarks nav, and it gets a
+// guide reference, for EPUB 2 reading systems.
+func (b *Book) setLandmark(n int, role, label string) {
+   var href string
+   var lmarks []landmark
+
+   href = b.Package.Manifest[n].Href
+   role = ugarit.LandmarkRole(role)
+   if label == "" {
+      label = ugarit.LandmarkLabel(role)
+   }
+
+   for _, lm := range b.landmarks {
+      if lm.href != href || lm.role != role {
+         lmarks = append(lmarks, lm)
+      }
+   }
+   b.landmarks = append(lmarks, landmark{href: href, role: role, label: label})
+
+   b.setGuide(Reference{Href: href, Type: ugarit.GuideType(role), Title: label})
+}
+
+// setGuide adds the reference to the guide, replacing the one of the same
+// type pointing to the same file.
+func (b *Book) setGuide(ref Reference) {
+   var guide []Reference
+
+   for _, r := range b.Package.Guide.Reference {
+      if r.Href != ref.Href || r.Type != ref.Type {
+         guide = append(guide, r)
+      }
+   }
+   b.Package.Guide.Reference = append(guide, ref)
+}
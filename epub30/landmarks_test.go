@@ -0,0 +1,98 @@
+package epub30_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestLandmarks(t *testing.T) {
+	var buf, buf2 testutil.BufCloser
+
+	pages := []struct {
+		path, body string
+		opt        *epub30.EPubOptions
+	}{
+		{"title.xhtml", `<body><h1>T</h1></body>`, &epub30.EPubOptions{Landmark: "titlepage"}},
+		{"copy.xhtml", `<body>
+<section id="c"><p>(c)</p></section>
+</body>`, &epub30.EPubOptions{Landmark: "copyright-page"}},
+		{"ch1.xhtml", `<body xmlns:epub="http://www.idpf.org/2007/ops" epub:type="chapter"><h1>One</h1></body>`, &epub30.EPubOptions{TOCItemTitle: "One", Landmark: "bodymatter"}},
+		{"thanks.xhtml", `<body><p>Thanks</p></body>`, &epub30.EPubOptions{Landmark: "acknowledgements"}},
+		{"idx.xhtml", `<body><p>Index</p></body>`, &epub30.EPubOptions{Landmark: "index", LandmarkTitle: "Subject Index"}},
+	}
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pages {
+		page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title></head>` + p.body + `</html>`
+		if _, _, _, err = b.AddPage(p.path, "application/xhtml+xml", strings.NewReader(page), "", p.opt); err != nil {
+			t.Fatalf("AddPage %s: %s", p.path, err)
+		}
+	}
+	gen, _ := epub30.NewIndexGenerator()
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+
+	var guide []string
+	for _, ref := range br.Guide() {
+		guide = append(guide, ref.Type+"="+ref.Href)
+	}
+	if got, want := strings.Join(guide, " "), "title-page=title.xhtml copyright-page=copy.xhtml text=ch1.xhtml acknowledgements=thanks.xhtml index=idx.xhtml toc=index.xhtml"; got != want {
+		t.Errorf("guide: got %q, want %q", got, want)
+	}
+
+	for p, want := range map[string]string{
+		"index.xhtml":  `<li><a href="title.xhtml" epub:type="titlepage">Title Page</a></li><li><a href="copy.xhtml" epub:type="copyright-page">Copyright</a></li><li><a href="ch1.xhtml" epub:type="bodymatter">Start</a></li><li><a href="thanks.xhtml" epub:type="acknowledgments">Acknowledgements</a></li><li><a href="idx.xhtml" epub:type="index">Subject Index</a></li>`,
+		"title.xhtml":  `<body xmlns:epub="http://www.idpf.org/2007/ops" epub:type="titlepage">`,
+		"copy.xhtml":   `<section xmlns:epub="http://www.idpf.org/2007/ops" epub:type="copyright-page" id="c">`,
+		"ch1.xhtml":    `<body xmlns:epub="http://www.idpf.org/2007/ops" epub:type="chapter bodymatter">`,
+		"thanks.xhtml": `epub:type="acknowledgments"`,
+	} {
+		r, err := br.DocReader(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%s: %s missing in %s", p, want, data)
+		}
+	}
+
+	// The landmarks survive editing
+	b2, err := epub30.Open(br, &buf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, _ = epub30.NewIndexGenerator()
+	if _, err = b2.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := b2.Open("index.xhtml")
+	data, _ := io.ReadAll(r)
+	if !strings.Contains(string(data), `<a href="idx.xhtml" epub:type="index">Subject Index</a>`) {
+		t.Errorf("reopened nav: got %s", data)
+	}
+}
@@ -0,0 +1,152 @@
+package epub30
+
+import (
+   "fmt"
+   "io"
+   "strings"
+   "github.com/PuerkitoBio/goquery"
+)
+
+// renditionValues lists the values allowed for each Rendition field
+var renditionValues = map[string][]string{
+   "layout":      {LayoutPrePaginated, LayoutReflowable},
+   "orientation": {"auto", "landscape", "portrait"},
+   "spread":      {"auto", "none", "landscape", "both"},
+   "flow":        {"auto", "paginated", "scrolled-continuous", "scrolled-doc"},
+   "page-spread": {"left", "right", "center"},
+}
+
+// SetRendition sets the fixed-layout settings of the whole book, also made
+// available through New. A pre-paginated layout makes a fixed-layout book,
+// the way comics and picture books are made: reading systems then show each
+// page as a whole, at the size set by its viewport. Empty fields drop the
+// corresponding metadata. Page settings override the book ones (see
+// EPubOptions.Rendition).
+func (b *Book) SetRendition(r *Rendition) error {
+   var err error
+
+   if b.err != nil {
+      return b.err
+   }
+
+   if r == nil {
+      r = &Rendition{}
+   }
+
+   err = r.check()
+   if err != nil {
+      return err
+   }
+
+   for _, p := range []struct {
+      name string
+      val  string
+   }{
+      {"layout", r.Layout},
+      {"orientation", r.Orientation},
+      {"spread", r.Spread},
+      {"flow", r.Flow},
+   } {
+      b.dropMeta(func(m Metatag) bool {
+         return m.Property == "rendition:" + p.name && m.Refines == ""
+      })
+      if p.val != "" {
+         b.AddMetadata("rendition:" + p.name, p.val)
+      }
+   }
+
+   if r.Layout != "" || r.Orientation != "" || r.Spread != "" || r.Flow != "" {
+      b.Package.Prefix = mergePrefix(b.Package.Prefix, "rendition: http://www.idpf.org/vocab/rendition/#")
+   }
+
+   b.rendition = *r
+   b.rendition.PageSpread = ""
+
+   return nil
+}
+
+// check tells whether the fields hold allowed values.
+func (r *Rendition) check() error {
+   for _, p := range []struct {
+      name string
+      val  string
+   }{
+      {"layout", r.Layout},
+      {"orientation", r.Orientation},
+      {"spread", r.Spread},
+      {"flow", r.Flow},
+      {"page-spread", r.PageSpread},
+   } {
+      if p.val == "" {
+         continue
+      }
+      ok := false
+      for _, v := range renditionValues[p.name] {
+         ok = ok || v == p.val
+      }
+      if !ok {
+         return ErrorInvalidRendition
+      }
+   }
+
+   if r.Width < 0 || r.Height < 0 {
+      return ErrorInvalidRendition
+   }
+
+   return nil
+}
+
+// spineProperties returns the spine itemref properties of a page with
+// these settings.
+func (r *Rendition) spineProperties() string {
+   var props []string
+
+   switch r.PageSpread {
+   case "left", "right":
+      props = append(props, "page-spread-" + r.PageSpread)
+   case "center":
+      props = append(props, "rendition:page-spread-center")
+   }
+
+   for _, p := range []struct {
+      name string
+      val  string
+   }{
+      {"layout", r.Layout},
+      {"orientation", r.Orientation},
+      {"spread", r.Spread},
+      {"flow", r.Flow},
+   } {
+      if p.val != "" {
+         props = append(props, "rendition:" + p.name + "-" + p.val)
+      }
+   }
+
+   return strings.Join(props, " ")
+}
+
+// setViewport adds a viewport meta with the given size to the head of the
+// page read from src, unless it already has one.
+func setViewport(src io.Reader, width, height int) (io.Reader, error) {
+   var doc *goquery.Document
+   var shtml string
+   var err error
+
+   doc, err = goquery.NewDocumentFromReader(src)
+   if err != nil {
+      return nil, err
+   }
+
+   if doc.Find(`meta[name="viewport"]`).Length() == 0 {
+      doc.Find("HEAD").Each(func(_ int, s *goquery.Selection) {
+         s.AppendHtml(fmt.Sprintf(`<meta name="viewport" content="width=%d, height=%d"></meta>`, width, height))
+      })
+   }
+
+   shtml, err = renderXHTML(doc)
+   if err != nil {
+      return nil, err
+   }
+
+   return strings.NewReader(shtml), nil
+}
@@ -0,0 +1,109 @@
+package epub30_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestFixedLayout(t *testing.T) {
+	var buf testutil.BufCloser
+
+	page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title></head><body><img src="p.png" alt=""/></body></html>`
+	sized := strings.Replace(page, "<title>", `<meta name="viewport" content="width=100, height=200"/><title>`, 1)
+
+	if _, err := epub30.New(&buf, nil, nil, nil, nil, nil, nil, epub30.Signature{}, nil, "", nil, &epub30.Rendition{Layout: "fixed"}); err != epub30.ErrorInvalidRendition {
+		t.Errorf("invalid layout: got %v", err)
+	}
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "rtl", nil,
+		&epub30.Rendition{Layout: epub30.LayoutPrePaginated, Spread: "landscape", Width: 600, Height: 800})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = b.AddFile("p.png", "image/png", strings.NewReader("PNG"), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []struct {
+		path string
+		page string
+		opt  interface{}
+	}{
+		{"p1.xhtml", page, &epub30.EPubOptions{Rendition: &epub30.Rendition{PageSpread: "center"}, TOCItemTitle: "Cover"}},
+		{"p2.xhtml", page, &epub30.EPubOptions{Rendition: &epub30.Rendition{PageSpread: "right"}}},
+		{"p3.xhtml", sized, &epub30.EPubOptions{Rendition: &epub30.Rendition{PageSpread: "left", Spread: "none"}}},
+		{"p4.xhtml", page, &epub30.EPubOptions{Rendition: &epub30.Rendition{Layout: epub30.LayoutReflowable}}},
+		{"p5.xhtml", page, nil},
+	} {
+		if _, _, _, err = b.AddPage(p.path, "application/xhtml+xml", strings.NewReader(p.page), "", p.opt); err != nil {
+			t.Fatalf("%s: %s", p.path, err)
+		}
+	}
+	if _, _, _, err = b.AddPage("p6.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub30.EPubOptions{Rendition: &epub30.Rendition{PageSpread: "top"}}); err != epub30.ErrorInvalidRendition {
+		t.Errorf("invalid page spread: got %v", err)
+	}
+
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+
+	md := br.Metadata()
+	if !strings.Contains(md.Prefix, "rendition: http://www.idpf.org/vocab/rendition/#") {
+		t.Errorf("prefix: got %q", md.Prefix)
+	}
+	got := map[string]string{}
+	for _, m := range md.Meta {
+		if strings.HasPrefix(m.Property, "rendition:") {
+			got[m.Property] = m.Value
+		}
+	}
+	if len(got) != 2 || got["rendition:layout"] != "pre-paginated" || got["rendition:spread"] != "landscape" {
+		t.Errorf("rendition metadata: got %v", got)
+	}
+
+	var props []string
+	for _, it := range br.Spine() {
+		props = append(props, strings.Join(it.Properties, " "))
+	}
+	if want := "rendition:page-spread-center|page-spread-right|page-spread-left rendition:spread-none|rendition:layout-reflowable|"; strings.Join(props, "|") != want {
+		t.Errorf("spine properties: got %q", strings.Join(props, "|"))
+	}
+
+	for p, want := range map[string]int{"p2.xhtml": 1, "p3.xhtml": 1, "p4.xhtml": 0, "p5.xhtml": 1} {
+		r, err := br.DocReader(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		if n := strings.Count(string(data), `name="viewport"`); n != want {
+			t.Errorf("%s: %d viewports in %s", p, n, data)
+		}
+		if n := strings.Count(string(data), "<!DOCTYPE"); n > 1 {
+			t.Errorf("%s: %d doctypes in %s", p, n, data)
+		}
+	}
+
+	r, err := br.FS(false).Open("META-INF/com.apple.ibooks.display-options.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	if !strings.Contains(string(data), `<option name="fixed-layout">true</option>`) {
+		t.Errorf("display options: got %s", data)
+	}
+}
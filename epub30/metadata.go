@@ -0,0 +1,159 @@
+package epub30
+
+import (
+   "strings"
+   "strconv"
+   "encoding/xml"
+   "github.com/luisfurquim/ugarit"
+)
+
+// dcElements lists the Dublin Core elements allowed in the package metadata
+var dcElements = []string{
+   "contributor", "coverage", "creator", "date", "description", "format",
+   "identifier", "language", "publisher", "relation", "rights", "source",
+   "subject", "title", "type",
+}
+
+// AddDC adds a Dublin Core element (subject, description, rights,
+// contributor, source, relation, coverage, type, format, or any other one:
+// title, creator...) to the book metadata, the "dc:" prefix being optional.
+// Options, if not nil, must be a *DCOptions, whose refinements are written
+// as metas refining the element.
+// It returns the element id.
+func (b *Book) AddDC(element string, value string, options interface{}) (string, error) {
+   var opt *DCOptions
+   var known bool
+
+   if b.err != nil {
+      return "", b.err
+   }
+
+   opt = &DCOptions{}
+   if options != nil {
+      switch options.(type) {
+      case *DCOptions:
+         opt = options.(*DCOptions)
+      default:
+         return "", ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   element = strings.TrimPrefix(element, "dc:")
+   for _, el := range dcElements {
+      known = known || el == element
+   }
+   if !known {
+      return "", ErrorInvalidDCElement
+   }
+
+   id := opt.ID
+   if id == "" {
+      id = b.newMetaID(element)
+   }
+
+   b.Package.Metadata.DC = append(b.Package.Metadata.DC, DCElement{
+      XMLName:  xml.Name{Local: "dc:" + element},
+      ID:       id,
+      Langattr: opt.Lang,
+      Dir:      opt.Dir,
+      Data:     value,
+   })
+
+   if opt.Role != "" {
+      b.AddRefinement(id, "role", opt.Role, "marc:relators")
+   }
+   if opt.FileAs != "" {
+      b.AddRefinement(id, "file-as", opt.FileAs, "")
+   }
+   if opt.AlternateScript != "" {
+      b.Package.Metadata.Metatag = append(b.Package.Metadata.Metatag, Metatag{
+         Refines:  "#" + id,
+         Property: "alternate-script",
+         Langattr: opt.AlternateScriptLang,
+         Data:     opt.AlternateScript,
+      })
+   }
+   if opt.TitleType != "" {
+      b.AddRefinement(id, "title-type", opt.TitleType, "")
+   }
+   if opt.DisplaySeq > 0 {
+      b.AddRefinement(id, "display-seq", strconv.Itoa(opt.DisplaySeq), "")
+   }
+   if opt.IdentifierType != "" {
+      if _, err := strconv.Atoi(opt.IdentifierType); err == nil {
+         b.AddRefinement(id, "identifier-type", opt.IdentifierType, "onix:codelist5")
+      } else {
+         b.AddRefinement(id, "identifier-type", opt.IdentifierType, "")
+      }
+   }
+
+   return id, nil
+}
+
+// AddRefinement adds a meta refining the metadata element (or meta, or
+// manifest item) with the given id, e.g. a role with the marc:relators
+// scheme.
+func (b *Book) AddRefinement(id, property, value, scheme string) {
+   b.Package.Metadata.Metatag = append(b.Package.Metadata.Metatag, Metatag{
+      Refines:  "#" + strings.TrimPrefix(id, "#"),
+      Property: property,
+      Scheme:   scheme,
+      Data:     value,
+   })
+}
+
+// refineCreators moves the Role and FileAs of the creators, invalid as
+// attributes in EPUB 3, to refines metas.
+func (b *Book) refineCreators() {
+   var c *Author
+
+   for i := range b.Package.Metadata.Creator {
+      c = &b.Package.Metadata.Creator[i]
+      if c.Role == "" && c.FileAs == "" {
+         continue
+      }
+      if c.ID == "" {
+         c.ID = b.newMetaID("creator")
+      }
+      if c.Role != "" {
+         b.AddRefinement(c.ID, "role", c.Role, "marc:relators")
+      }
+      if c.FileAs != "" {
+         b.AddRefinement(c.ID, "file-as", c.FileAs, "")
+      }
+      c.Role, c.FileAs = "", ""
+   }
+}
+
+// newMetaID returns an id, made of pfx and a number, not used by the
+// package yet.
+func (b *Book) newMetaID(pfx string) string {
+   return ugarit.NewID(pfx, b.usedIDs())
+}
+
+// usedIDs collects the ids of the metadata and manifest items.
+func (b *Book) usedIDs() map[string]bool {
+   var used map[string]bool
+   var md *Metadata
+
+   md = &b.Package.Metadata
+   used = map[string]bool{}
+   for _, ident := range md.Identifier {
+      used[ident.ID] = true
+   }
+   for _, c := range md.Creator {
+      used[c.ID] = true
+   }
+   for _, el := range md.DC {
+      used[el.ID] = true
+   }
+   for _, m := range md.Metatag {
+      used[m.ID] = true
+   }
+   for _, m := range b.Package.Manifest {
+      used[m.ID] = true
+   }
+   delete(used, "")
+
+   return used
+}
@@ -0,0 +1,100 @@
+package epub30_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestDCMetadata(t *testing.T) {
+	var buf testutil.BufCloser
+
+	creators := []epub30.Author{{Data: "Jane Doe", Role: "aut", FileAs: "Doe, Jane"}}
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"urn:isbn:9780306406157"}, creators, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creators[0].Role != "aut" {
+		t.Errorf("New changed the creators passed")
+	}
+	for _, el := range []struct {
+		name, value string
+		opt         *epub30.DCOptions
+	}{
+		{"subject", "Fiction", nil},
+		{"dc:subject", "Mystery", &epub30.DCOptions{Lang: "en"}},
+		{"description", "A story.", nil},
+		{"rights", "All rights reserved", nil},
+		{"contributor", "Haruki Murakami", &epub30.DCOptions{ID: "trl", Role: "trl", FileAs: "Murakami, Haruki", AlternateScript: "村上 春樹", AlternateScriptLang: "ja"}},
+		{"title", "The Subtitle", &epub30.DCOptions{TitleType: "subtitle", DisplaySeq: 2}},
+		{"identifier", "9780306406157", &epub30.DCOptions{IdentifierType: "15"}},
+		{"source", "urn:isbn:0306406152", nil},
+		{"relation", "http://example.com/other", nil},
+		{"coverage", "Tokyo", nil},
+		{"type", "text", nil},
+		{"format", "application/epub+zip", nil},
+	} {
+		var opt interface{}
+		if el.opt != nil {
+			opt = el.opt
+		}
+		if _, err = b.AddDC(el.name, el.value, opt); err != nil {
+			t.Fatalf("AddDC %s: %s", el.name, err)
+		}
+	}
+	if _, err = b.AddDC("dc:foo", "x", nil); err != epub30.ErrorInvalidDCElement {
+		t.Errorf("invalid element: got %v", err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opf := string(testutil.ZipEntry(t, buf.Bytes(), "content.opf"))
+	for _, bad := range []string{` role="`, ` file-as="`} {
+		if strings.Contains(opf, bad) {
+			t.Errorf("content.opf has the EPUB 2 attribute %s: %s", bad, opf)
+		}
+	}
+	for _, want := range []string{
+		`<meta refines="#creator1" property="role" scheme="marc:relators">aut</meta>`,
+		`<meta xml:lang="ja" refines="#trl" property="alternate-script">村上 春樹</meta>`,
+		`<meta refines="#identifier1" property="identifier-type" scheme="onix:codelist5">15</meta>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("content.opf: %s missing in %s", want, opf)
+		}
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+
+	md := br.Metadata()
+	if len(md.Creators) != 1 || md.Creators[0].Role != "aut" || md.Creators[0].FileAs != "Doe, Jane" {
+		t.Errorf("creators: got %+v", md.Creators)
+	}
+	if len(md.Contributors) != 1 || md.Contributors[0].Role != "trl" || md.Contributors[0].Refinement("alternate-script") != "村上 春樹" {
+		t.Errorf("contributors: got %+v", md.Contributors)
+	}
+	if len(md.Subjects) != 2 || md.Subjects[1].Lang != "en" || len(md.Descriptions) != 1 || len(md.Rights) != 1 {
+		t.Errorf("subjects, descriptions, rights: got %+v %+v %+v", md.Subjects, md.Descriptions, md.Rights)
+	}
+	if len(md.Titles) != 2 || md.Titles[1].Refinement("title-type") != "subtitle" || md.Titles[1].Refinement("display-seq") != "2" {
+		t.Errorf("titles: got %+v", md.Titles)
+	}
+	for name, n := range map[string]int{"sources": len(md.Sources), "relations": len(md.Relations), "coverages": len(md.Coverages), "types": len(md.Types), "formats": len(md.Formats)} {
+		if n != 1 {
+			t.Errorf("%s: got %d", name, n)
+		}
+	}
+}
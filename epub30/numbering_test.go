@@ -0,0 +1,69 @@
+package epub30_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestTOCNumbering(t *testing.T) {
+	var buf testutil.BufCloser
+
+	page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title></head><body><p>intro</p><h2>Title</h2><section id="s1"><h3>Sub</h3></section></body></html>`
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.SubSectionStyle(ugarit.NewArabicNumbering("Chapter", true))
+	b.NumberHeadings(true)
+
+	_, _, one, err := b.AddPage("one.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub30.EPubOptions{TOCItemTitle: "One"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = b.AddPage("two.xhtml", "application/xhtml+xml", strings.NewReader(page), "", &epub30.EPubOptions{TOCItemTitle: "Two", TOC: one}); err != nil {
+		t.Fatal(err)
+	}
+	_, _, three, err := b.AddPage("three.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub30.EPubOptions{TOCItemTitle: "Three"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	three.SubSectionStyle(ugarit.NewLowerLetterNumbering("Section", false))
+	if _, _, _, err = b.AddPage("four.xhtml", "application/xhtml+xml", strings.NewReader(testutil.Chapter), "", &epub30.EPubOptions{TOCItemTitle: "Four", TOC: three}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Generating the TOC again must not number the headings twice
+	for i := 0; i < 2; i++ {
+		gen, _ := epub30.NewIndexGenerator()
+		if _, err = b.AddTOC(gen, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for p, wants := range map[string][]string{
+		"index.xhtml": {">Chapter 1 One</a>", " Chapter 1.1 Two</a>", ">Chapter 2 Three</a>", " Section a Four</a>"},
+		"two.xhtml":   {`<p>intro</p><h2><span class="section-number">Chapter 1.1</span> Title</h2>`},
+		"four.xhtml":  {`<h1><span class="section-number">Section a</span> Chapter 1</h1>`},
+	} {
+		r, err := b.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		for _, want := range wants {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s: %s missing in %s", p, want, data)
+			}
+		}
+		if n := strings.Count(string(data), "section-number"); p != "index.xhtml" && n != 1 {
+			t.Errorf("%s: %d section numbers", p, n)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package epub30
+
+import (
+   "io"
+   "fmt"
+   "strings"
+   "encoding/xml"
+   "github.com/luisfurquim/ugarit"
+)
+
+// Open loads the book read by src into a new Book which will be saved to target.
+// Manifest, spine, metadata, guide and TOC are kept, so pages, files and
+// metadata may be added on top of them before Close writes the new archive.
+// Calling AddFile with the path of a loaded file replaces its contents.
+// Calling AddTOC replaces the loaded TOC file of the same kind (nav or NCX),
+// keeping the loaded TOC entries. Loading an EPub 2 book requires an AddTOC
+// with an epub30 IndexGenerator, as EPub 3 mandates a nav document.
+// The loaded files are copied from src when the book is closed, so src must
+// not be closed before that.
+func Open(src ugarit.BookReader, target io.WriteCloser) (*Book, error) {
+   var b *Book
+   var err error
+   var byId map[string]int
+   var md ugarit.Metadata
+
+   md = src.Metadata()
+
+   b, err = New(target, nil, nil, nil, nil, nil, nil, Signature{}, nil, src.PageProgression(), nil)
+   if err != nil {
+      return nil, err
+   }
+
+   b.src = src
+
+   b.loadMetadata(md)
+
+   for _, m := range md.Meta {
+      if m.Refines != "" {
+         continue
+      }
+      switch m.Property {
+      case "rendition:layout":
+         b.rendition.Layout = m.Value
+      case "rendition:orientation":
+         b.rendition.Orientation = m.Value
+      case "rendition:spread":
+         b.rendition.Spread = m.Value
+      case "rendition:flow":
+         b.rendition.Flow = m.Value
+      }
+   }
+
+   byId = map[string]int{}
+   for _, dm := range src.Docs() {
+      // The book keeps the decoded hrefs, which name the archive entries
+      name := ugarit.UnescapeHref(dm.Path)
+      byId[dm.ID] = len(b.Package.Manifest)
+      b.Package.Manifest = append(b.Package.Manifest, Manifest{
+         ID:           dm.ID,
+         Href:         name,
+         MediaType:    dm.MimeType,
+         Properties:   strings.Join(dm.Properties, " "),
+         MediaOverlay: dm.MediaOverlay,
+      })
+      b.ManifIndex[name] = dm.ID
+      b.files[name] = &file{loaded: dm.Path, obfuscation: dm.Obfuscation}
+
+      if dm.MimeType == "application/x-dtbncx+xml" && b.Package.Spine.Toc == "" {
+         b.Package.Spine.Toc = dm.ID
+      }
+
+      // Generated ids must not collide with the loaded ones
+      var n int
+      if _, err = fmt.Sscanf(dm.ID, "pg%d", &n); err == nil && n >= b.fid {
+         b.fid = n + 1
+      }
+   }
+
+   for _, it := range src.Spine() {
+      si := SpineItem{
+         IDref:      it.Doc.ID,
+         ID:         it.ID,
+         Properties: strings.Join(it.Properties, " "),
+      }
+      if !it.Linear {
+         si.Linear = "no"
+      }
+      b.Package.Spine.Itemref = append(b.Package.Spine.Itemref, si)
+   }
+
+   for _, ref := range src.Guide() {
+      ref.Href = ugarit.UnescapeHref(ref.Href)
+      b.Package.Guide.Reference = append(b.Package.Guide.Reference, Reference{
+         Href:  ref.Href,
+         Type:  ref.Type,
+         Title: ref.Title,
+      })
+      switch ref.Type {
+      case "cover":
+         b.coverPath = ref.Href
+      case "toc":
+         // AddTOC references the TOC it makes
+      default:
+         b.landmarks = append(b.landmarks, landmark{
+            href:  ref.Href,
+            role:  ugarit.LandmarkRole(ref.Type),
+            label: ref.Title,
+         })
+      }
+   }
+
+   b.index = b.loadTOC(src.TOC(), byId)
+
+   return b, nil
+}
+
+// loadMetadata copies the source metadata into the package, keeping the
+// element ids refines entries point to. EPub 2 role, file-as and scheme
+// attributes are not allowed in EPub 3, so they become refines entries.
+func (b *Book) loadMetadata(md ugarit.Metadata) {
+   var meta *Metadata
+   var nid int
+   var used map[string]bool
+   var idents []ugarit.Identifier
+
+   meta = &b.Package.Metadata
+
+   if len(md.Languages) > 0 {
+      b.Package.Langattr = md.Languages[0].Value
+   }
+
+   b.Package.Prefix = mergePrefix(b.Package.Prefix, md.Prefix)
+
+   used = map[string]bool{}
+   for _, m := range md.Meta {
+      used[m.ID] = true
+   }
+   for _, ident := range md.Identifiers {
+      used[ident.ID] = true
+   }
+   for _, p := range md.Creators {
+      used[p.ID] = true
+   }
+   for _, p := range md.Contributors {
+      used[p.ID] = true
+   }
+   for _, d := range md.Dates {
+      used[d.ID] = true
+   }
+   for _, values := range [][]ugarit.MetaValue{md.Titles, md.Languages, md.Publishers, md.Subjects, md.Descriptions, md.Rights, md.Sources, md.Relations, md.Coverages, md.Types, md.Formats} {
+      for _, mv := range values {
+         used[mv.ID] = true
+      }
+   }
+
+   // id returns the element id, making one up for the refines to point to
+   id := func(mv *ugarit.MetaValue, pfx string) string {
+      for mv.ID == "" {
+         nid++
+         if !used[fmt.Sprintf("%s%d", pfx, nid)] {
+            mv.ID = fmt.Sprintf("%s%d", pfx, nid)
+            used[mv.ID] = true
+         }
+      }
+      return mv.ID
+   }
+
+   // The package must name one of the identifiers as the unique one
+   idents = append([]ugarit.Identifier(nil), md.Identifiers...)
+   b.Package.UID = ""
+   for _, ident := range idents {
+      if ident.ID != "" && ident.ID == md.UniqueIdentifier {
+         b.Package.UID = ident.ID
+      }
+   }
+   if b.Package.UID == "" && len(idents) > 0 {
+      b.Package.UID = id(&idents[0].MetaValue, "pub-id")
+   }
+
+   refine := func(id, property, scheme, val string) {
+      meta.Metatag = append(meta.Metatag, Metatag{
+         Refines:  "#" + id,
+         Property: property,
+         Scheme:   scheme,
+         Data:     val,
+      })
+   }
+
+   dc := func(name string, mv ugarit.MetaValue) {
+      meta.DC = append(meta.DC, DCElement{
+         XMLName:  xml.Name{Local: "dc:" + name},
+         ID:       mv.ID,
+         Langattr: mv.Lang,
+         Dir:      mv.Dir,
+         Data:     mv.Value,
+      })
+   }
+
+   // Plain values fit the string slices, the others go to DC
+   plain := func(name string, values []ugarit.MetaValue, dst *[]string) {
+      for _, mv := range values {
+         if mv.ID == "" && mv.Lang == "" && mv.Dir == "" {
+            *dst = append(*dst, mv.Value)
+         } else {
+            dc(name, mv)
+         }
+      }
+   }
+
+   plain("title", md.Titles, &meta.Title)
+   plain("language", md.Languages, &meta.Language)
+   plain("publisher", md.Publishers, &meta.Publisher)
+
+   for _, ident := range idents {
+      if ident.Scheme != "" && ident.Refinement("identifier-type") == "" {
+         refine(id(&ident.MetaValue, "id"), "identifier-type", "", ident.Scheme)
+      }
+      meta.Identifier = append(meta.Identifier, Identifier{Data: ident.Value, ID: ident.ID})
+   }
+
+   for _, p := range md.Creators {
+      if p.Role != "" && p.Refinement("role") == "" {
+         refine(id(&p.MetaValue, "creator"), "role", "marc:relators", p.Role)
+      }
+      if p.FileAs != "" && p.Refinement("file-as") == "" {
+         refine(id(&p.MetaValue, "creator"), "file-as", "", p.FileAs)
+      }
+      meta.Creator = append(meta.Creator, Author{ID: p.ID, Data: p.Value})
+   }
+
+   for _, p := range md.Contributors {
+      if p.Role != "" && p.Refinement("role") == "" {
+         refine(id(&p.MetaValue, "contributor"), "role", "marc:relators", p.Role)
+      }
+      if p.FileAs != "" && p.Refinement("file-as") == "" {
+         refine(id(&p.MetaValue, "contributor"), "file-as", "", p.FileAs)
+      }
+      dc("contributor", p.MetaValue)
+   }
+
+   for _, d := range md.Dates {
+      if d.ID == "" {
+         meta.Date = append(meta.Date, Date{Data: d.Value})
+      } else {
+         dc("date", d.MetaValue)
+      }
+   }
+
+   for _, el := range []struct {
+      name   string
+      values []ugarit.MetaValue
+   }{
+      {"subject", md.Subjects},
+      {"description", md.Descriptions},
+      {"rights", md.Rights},
+      {"source", md.Sources},
+      {"relation", md.Relations},
+      {"coverage", md.Coverages},
+      {"type", md.Types},
+      {"format", md.Formats},
+   } {
+      for _, mv := range el.values {
+         dc(el.name, mv)
+      }
+   }
+
+   for _, m := range md.Meta {
+      // Close stamps a new modification date
+      if m.Property == "dcterms:modified" && m.Refines == "" {
+         continue
+      }
+      meta.Metatag = append(meta.Metatag, Metatag{
+         Name:     m.Name,
+         Langattr: m.Lang,
+         ID:       m.ID,
+         Refines:  m.Refines,
+         Property: m.Property,
+         Scheme:   m.Scheme,
+         Content:  m.Content,
+         Data:     m.Value,
+      })
+   }
+}
+
+// loadTOC converts the TOC entries read from the source book. Entries not
+// pointing to a manifest item (headings without links, external links) are
+// skipped, their children taking their place.
+func (b *Book) loadTOC(parent *ugarit.TOCNode, byId map[string]int) TOC {
+   var toc TOC
+
+   toc = make(TOC, 0, parent.TOCLen())
+   for _, n := range parent.Children {
+      pos, ok := -1, false
+      if n.Doc != nil {
+         pos, ok = byId[n.Doc.ID]
+      }
+      if !ok {
+         toc = append(toc, b.loadTOC(n, byId)...)
+         continue
+      }
+
+      toc = append(toc, &TOCContent{
+         ndx:        pos,
+         Title:      n.Title,
+         index:      b.loadTOC(n, byId),
+         fragment:   n.Fragment(),
+      })
+   }
+
+   return toc
+}
+
+// dropLoaded removes the loaded files matching the filter from the book.
+func (b *Book) dropLoaded(match func(Manifest) bool) {
+   for i := 0; i < len(b.Package.Manifest); {
+      m := b.Package.Manifest[i]
+      if f, ok := b.files[m.Href]; !ok || f.loaded == "" || !match(m) {
+         i++
+         continue
+      }
+      b.removeItem(i)
+   }
+}
+
+// copyLoaded copies to w the contents of the file at path in the source book.
+func (b *Book) copyLoaded(w io.Writer, path string) error {
+   var r io.Reader
+   var err error
+
+   r, err = b.src.DocReader(path)
+   if err != nil {
+      return err
+   }
+
+   _, err = io.Copy(w, r)
+   if rc, ok := r.(io.Closer); ok {
+      rc.Close()
+   }
+
+   return err
+}
+
+// mergePrefix adds to the prefix attribute value pfx the declarations of
+// more whose prefix is not yet declared.
+func mergePrefix(pfx, more string) string {
+   var fields []string
+
+   fields = strings.Fields(more)
+   for i := 0; i+1 < len(fields); i += 2 {
+      if !strings.HasSuffix(fields[i], ":") || strings.Contains(" "+pfx, " "+fields[i]+" ") {
+         continue
+      }
+      if pfx != "" {
+         pfx += " "
+      }
+      pfx += fields[i] + " " + fields[i+1]
+   }
+
+   return pfx
+}
@@ -0,0 +1,254 @@
+package epub30
+
+import (
+   "fmt"
+   "path"
+   "bytes"
+   "strings"
+   "strconv"
+   "time"
+   "encoding/xml"
+   "github.com/luisfurquim/ugarit"
+)
+
+// AddMediaOverlay synchronizes the page at pagePath with the audio file at
+// audioPath, both already added to the book: while the audio plays, reading
+// systems highlight the page element named by each clip, so read-along books
+// can be made. It stores a SMIL document holding the clips, in order, and
+// links it to the page through media-overlay. The overlay duration (the sum
+// of the clip durations) is written as a media:duration meta refining the
+// SMIL item, and the book duration as a plain media:duration meta, updated on
+// every call. The media:active-class meta defaults to
+// "-epub-media-overlay-active", which the book CSS should style.
+// Calling it again for the same page replaces its overlay.
+// Options, if not nil, must be a *MediaOverlayOptions.
+// It returns the manifest id of the SMIL document.
+func (b *Book) AddMediaOverlay(pagePath string, audioPath string, clips []Clip, options interface{}) (string, error) {
+   var opt *MediaOverlayOptions
+   var page, audio int
+   var doc smil
+   var dir, smilPath, id, moved string
+   var total time.Duration
+   var buf bytes.Buffer
+   var err error
+
+   if b.err != nil {
+      return "", b.err
+   }
+
+   opt = &MediaOverlayOptions{}
+   if options != nil {
+      switch options.(type) {
+      case *MediaOverlayOptions:
+         opt = options.(*MediaOverlayOptions)
+      default:
+         return "", ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   page = b.lookup(pagePath)
+   audio = b.lookup(audioPath)
+   if page < 0 || audio < 0 {
+      return "", ugarit.ErrorFileNotFound
+   }
+
+   if len(clips) == 0 {
+      return "", ErrorInvalidClip
+   }
+
+   // The SMIL document of a previous call is reused, unless moved
+   smilPath = relPath(opt.Path)
+   id = opt.ID
+   for _, m := range b.Package.Manifest {
+      if m.ID == "" || m.ID != b.Package.Manifest[page].MediaOverlay {
+         continue
+      }
+      if smilPath != "" && smilPath != relPath(m.Href) {
+         moved = m.Href
+         break
+      }
+      smilPath, id = m.Href, m.ID
+      break
+   }
+   if smilPath == "" {
+      smilPath = strings.TrimSuffix(pagePath, path.Ext(pagePath)) + ".smil"
+   }
+   smilPath = relPath(smilPath)
+   dir = path.Dir(smilPath)
+
+   doc = smil{
+      Xmlns:     "http://www.w3.org/ns/SMIL",
+      XmlnsEpub: "http://www.idpf.org/2007/ops",
+      Version:   "3.0",
+      Body: smilBody{
+         Textref: relHref(dir, relPath(b.Package.Manifest[page].Href)),
+      },
+   }
+
+   for i, c := range clips {
+      if c.ID == "" || c.ClipBegin < 0 || c.ClipEnd <= c.ClipBegin {
+         return "", ErrorInvalidClip
+      }
+      doc.Body.Par = append(doc.Body.Par, smilPar{
+         ID: fmt.Sprintf("par%d", i+1),
+         Text: smilText{
+            Src: doc.Body.Textref + "#" + c.ID,
+         },
+         Audio: smilAudio{
+            Src:       relHref(dir, relPath(b.Package.Manifest[audio].Href)),
+            ClipBegin: clockValue(c.ClipBegin),
+            ClipEnd:   clockValue(c.ClipEnd),
+         },
+      })
+      total += c.ClipEnd - c.ClipBegin
+   }
+
+   buf.WriteString(xml.Header)
+   err = xml.NewEncoder(&buf).Encode(doc)
+   if err != nil {
+      return "", err
+   }
+
+   // The old overlay is only dropped once the new one is ready
+   if moved != "" {
+      err = b.Remove(moved)
+      if err != nil {
+         return "", err
+      }
+      page = b.lookup(pagePath)
+   }
+
+   id, _, err = b.AddFile(smilPath, "application/smil+xml", &buf, id, nil)
+   if err != nil {
+      return "", err
+   }
+
+   // AddFile appends, so the page position is kept
+   b.Package.Manifest[page].MediaOverlay = id
+
+   b.dropMeta(func(m Metatag) bool {
+      return m.Property == "media:duration" && m.Refines == "#" + id
+   })
+   b.Package.Metadata.Metatag = append(b.Package.Metadata.Metatag, Metatag{
+      Refines:  "#" + id,
+      Property: "media:duration",
+      Data:     clockValue(total),
+   })
+   b.setDuration()
+
+   if opt.ActiveClass != "" || !b.hasMeta("media:active-class") {
+      if opt.ActiveClass == "" {
+         opt.ActiveClass = "-epub-media-overlay-active"
+      }
+      b.setMeta("media:active-class", opt.ActiveClass)
+   }
+   if opt.PlaybackActiveClass != "" {
+      b.setMeta("media:playback-active-class", opt.PlaybackActiveClass)
+   }
+
+   return id, nil
+}
+
+// setDuration sets the book media:duration to the sum of the media overlay
+// durations, or drops it when there are no media overlays left.
+func (b *Book) setDuration() {
+   var total time.Duration
+   var n int
+
+   for _, m := range b.Package.Metadata.Metatag {
+      if m.Property == "media:duration" && m.Refines != "" {
+         if d, ok := parseClock(m.Data); ok {
+            total += d
+         }
+         n++
+      }
+   }
+
+   b.dropMeta(func(m Metatag) bool {
+      return m.Property == "media:duration" && m.Refines == ""
+   })
+   if n > 0 {
+      b.AddMetadata("media:duration", clockValue(total))
+   }
+}
+
+// setMeta sets the value of the (book level) meta with the given property.
+func (b *Book) setMeta(property, val string) {
+   b.dropMeta(func(m Metatag) bool {
+      return m.Property == property && m.Refines == ""
+   })
+   b.AddMetadata(property, val)
+}
+
+// hasMeta tells whether there is a (book level) meta with the given property.
+func (b *Book) hasMeta(property string) bool {
+   for _, m := range b.Package.Metadata.Metatag {
+      if m.Property == property && m.Refines == "" {
+         return true
+      }
+   }
+   return false
+}
+
+// dropMeta removes the metas matching the filter.
+func (b *Book) dropMeta(match func(Metatag) bool) {
+   var metas []Metatag
+
+   for _, m := range b.Package.Metadata.Metatag {
+      if !match(m) {
+         metas = append(metas, m)
+      }
+   }
+   b.Package.Metadata.Metatag = metas
+}
+
+// clockValue formats d as a SMIL full clock value, e.g. "0:01:02.500".
+func clockValue(d time.Duration) string {
+   var ms int64
+
+   ms = d.Milliseconds()
+   return fmt.Sprintf("%d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// parseClock parses a SMIL clock value: full ("1:02:03.5"), partial
+// ("02:03.5") or timecount ("3.5s", "200ms", "2min", "1h").
+func parseClock(s string) (time.Duration, bool) {
+   var parts []string
+   var d time.Duration
+   var f float64
+   var err error
+
+   s = strings.TrimSpace(s)
+   if strings.Contains(s, ":") {
+      parts = strings.Split(s, ":")
+      if len(parts) > 3 {
+         return 0, false
+      }
+      for i, p := range parts {
+         f, err = strconv.ParseFloat(p, 64)
+         if err != nil || f < 0 {
+            return 0, false
+         }
+         d += time.Duration(f * float64(time.Second)) * []time.Duration{1, 60, 3600}[len(parts)-1-i]
+      }
+      return d, true
+   }
+
+   unit := time.Second
+   for _, u := range []struct {
+      suffix string
+      unit   time.Duration
+   }{{"ms", time.Millisecond}, {"min", time.Minute}, {"h", time.Hour}, {"s", time.Second}} {
+      if strings.HasSuffix(s, u.suffix) {
+         s, unit = strings.TrimSuffix(s, u.suffix), u.unit
+         break
+      }
+   }
+
+   f, err = strconv.ParseFloat(s, 64)
+   if err != nil || f < 0 {
+      return 0, false
+   }
+
+   return time.Duration(f * float64(unit)), true
+}
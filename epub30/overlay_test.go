@@ -0,0 +1,117 @@
+package epub30_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestMediaOverlay(t *testing.T) {
+	var buf testutil.BufCloser
+
+	page := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>P</title></head><body><p><span id="w1">Once</span> <span id="w2">upon</span></p></body></html>`
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = b.AddFile("audio/p1.mp3", "audio/mpeg", strings.NewReader("ID3"), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"text/p1.xhtml", "text/p2.xhtml"} {
+		if _, _, _, err = b.AddPage(p, "application/xhtml+xml", strings.NewReader(page), "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clips := []epub30.Clip{
+		{ID: "w1", ClipBegin: 0, ClipEnd: 1200 * time.Millisecond},
+		{ID: "w2", ClipBegin: 1200 * time.Millisecond, ClipEnd: 2 * time.Second},
+	}
+	if _, err = b.AddMediaOverlay("text/p1.xhtml", "audio/p1.mp3", []epub30.Clip{{ID: "w1", ClipEnd: time.Hour}}, nil); err != nil {
+		t.Fatalf("AddMediaOverlay: %s", err)
+	}
+	// Replaced by the second call
+	id1, err := b.AddMediaOverlay("text/p1.xhtml", "audio/p1.mp3", clips, nil)
+	if err != nil {
+		t.Fatalf("AddMediaOverlay: %s", err)
+	}
+	if _, err = b.AddMediaOverlay("text/p2.xhtml", "audio/p1.mp3", clips, nil); err != nil {
+		t.Fatalf("AddMediaOverlay: %s", err)
+	}
+	if _, err = b.AddMediaOverlay("text/p2.xhtml", "/audio/p1.mp3", clips[1:], &epub30.MediaOverlayOptions{Path: "smil/p2.smil", ActiveClass: "hl"}); err != nil {
+		t.Fatalf("AddMediaOverlay: %s", err)
+	}
+	if _, err = b.AddMediaOverlay("text/p2.xhtml", "audio/p1.mp3", []epub30.Clip{{ID: "w1", ClipBegin: time.Second, ClipEnd: time.Second}}, nil); err != epub30.ErrorInvalidClip {
+		t.Errorf("empty clip: got %v", err)
+	}
+	// A failed move keeps the overlay in place
+	if _, err = b.AddMediaOverlay("text/p2.xhtml", "audio/p1.mp3", []epub30.Clip{{ID: ""}}, &epub30.MediaOverlayOptions{Path: "other.smil"}); err != epub30.ErrorInvalidClip {
+		t.Errorf("invalid clip: got %v", err)
+	}
+	if _, err = b.AddMediaOverlay("text/none.xhtml", "audio/p1.mp3", clips, nil); err != ugarit.ErrorFileNotFound {
+		t.Errorf("missing page: got %v", err)
+	}
+
+	findings, err := b.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dm, ok := br.ItemByPath("text/p1.xhtml"); !ok || dm.MediaOverlay != id1 {
+		t.Errorf("media-overlay: got %+v", dm)
+	}
+	// The first SMIL document of p2 was moved
+	if _, ok := br.ItemByPath("text/p2.smil"); ok {
+		t.Errorf("text/p2.smil: not removed")
+	}
+
+	r, err := br.DocReader("text/p1.smil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	for _, want := range []string{`epub:textref="p1.xhtml"`, `<text src="p1.xhtml#w2">`, `<audio src="../audio/p1.mp3" clipBegin="0:00:01.200" clipEnd="0:00:02.000">`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("smil: %s missing in %s", want, data)
+		}
+	}
+
+	got := map[string]string{}
+	for _, m := range br.Metadata().Meta {
+		if strings.HasPrefix(m.Property, "media:") {
+			got[m.Refines+m.Property] = m.Value
+		}
+	}
+	for k, v := range map[string]string{
+		"#" + id1 + "media:duration": "0:00:02.000",
+		"media:duration":             "0:00:02.800",
+		"media:active-class":         "hl",
+	} {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("media metadata: got %v", got)
+	}
+}
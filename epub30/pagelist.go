@@ -0,0 +1,155 @@
+package epub30
+
+import (
+   "io"
+   "fmt"
+   "bytes"
+   "encoding/xml"
+   "golang.org/x/net/html"
+   "golang.org/x/net/html/atom"
+   "github.com/luisfurquim/ugarit"
+)
+
+// AddPageBreak registers a print page break, so readers can cite the page
+// numbers of the print edition: the page labeled label starts in the book
+// file at path, at the element with the given id or, if id is "", at the
+// top of the file. AddTOC lists the page breaks, in the order they were
+// registered, in the page-list nav.
+// Options, if not nil, must be a *ugarit.PageBreakOptions. If it has
+// Insert set, an empty pagebreak span is inserted into the page, with the
+// given id or a generated one.
+func (b *Book) AddPageBreak(label string, path string, id string, options interface{}) error {
+   var opt *ugarit.PageBreakOptions
+   var n int
+   var r io.Reader
+   var page []byte
+   var err error
+
+   if b.err != nil {
+      return b.err
+   }
+
+   if options != nil {
+      switch options.(type) {
+      case *ugarit.PageBreakOptions:
+         opt = options.(*ugarit.PageBreakOptions)
+      default:
+         return ugarit.ErrorInvalidOptionType
+      }
+   }
+
+   n = b.lookup(path)
+   if n < 0 {
+      return ugarit.ErrorFileNotFound
+   }
+
+   if opt != nil && opt.Insert {
+      if id == "" {
+         id = fmt.Sprintf("pagebreak%d", len(b.pages)+1)
+      }
+
+      r, err = b.Open(path)
+      if err != nil {
+         return err
+      }
+      page, err = io.ReadAll(r)
+      if err != nil {
+         return err
+      }
+
+      page, err = ugarit.InsertPageBreak(page, id, label, opt.Before, true)
+      if err != nil {
+         return err
+      }
+
+      _, _, err = b.addfile(b.Package.Manifest[n].Href, bytes.NewReader(page), b.Package.Manifest[n].ID)
+      if err != nil {
+         return err
+      }
+   }
+
+   b.pages = append(b.pages, pageBreak{
+      label: label,
+      href:  b.Package.Manifest[n].Href,
+      id:    id,
+   })
+
+   return nil
+}
+
+// SetPageBreakSource names the print edition the page breaks come from,
+// usually by its ISBN ("urn:isbn:..."), as dc:source and
+// a11y:pageBreakSource metadata.
+func (b *Book) SetPageBreakSource(source string) {
+   var found bool
+
+   for _, dc := range b.Package.Metadata.DC {
+      if dc.XMLName.Local == "dc:source" && dc.Data == source {
+         found = true
+      }
+   }
+   if !found {
+      b.Package.Metadata.DC = append(b.Package.Metadata.DC, DCElement{
+         XMLName: xml.Name{Local: "dc:source"},
+         Data:    source,
+      })
+   }
+
+   b.setMeta("a11y:pageBreakSource", source)
+}
+
+// addPageList passes the page breaks to gen, if it makes page lists.
+func (b *Book) addPageList(gen ugarit.IndexGenerator) error {
+   var plg ugarit.PageListGenerator
+   var ok bool
+   var href string
+   var txt *html.Node
+   var err error
+
+   plg, ok = gen.(ugarit.PageListGenerator)
+   if !ok {
+      return nil
+   }
+
+   for _, pb := range b.pages {
+      href = relPath(pb.href)
+      if pb.id != "" {
+         href += "#" + pb.id
+      }
+
+      txt = &html.Node{
+         Type: html.TextNode,
+         Data: pb.label,
+      }
+      err = plg.AddPageTarget(&html.Node{
+         FirstChild: txt,
+         LastChild:  txt,
+         Type:       html.ElementNode,
+         DataAtom:   atom.A,
+         Data:       "a",
+         Attr: []html.Attribute{
+            html.Attribute{
+               Key: "href",
+               Val: href,
+            },
+         },
+      })
+      if err != nil {
+         return err
+      }
+   }
+
+   return nil
+}
+
+// AddPageTarget appends a page to the page-list nav.
+func (gen *IndexGenerator) AddPageTarget(item *html.Node) error {
+   gen.doc.Find("#plist").Nodes[0].AppendChild(&html.Node{
+      FirstChild: item,
+      LastChild:  item,
+      Type:       html.ElementNode,
+      DataAtom:   atom.Li,
+      Data:       "li",
+   })
+   return nil
+}
@@ -0,0 +1,103 @@
+package epub30_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestPageList(t *testing.T) {
+	var buf testutil.BufCloser
+
+	ch2 := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Ch2</title></head><body><p>a</p><p id="p2">b</p></body></html>`
+
+	b, err := epub30.New(&buf, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range [][2]string{{"text/ch1.xhtml", testutil.Chapter}, {"text/ch2.xhtml", ch2}} {
+		if _, _, _, err = b.AddPage(p[0], "application/xhtml+xml", strings.NewReader(p[1]), "", &epub30.EPubOptions{TOCItemTitle: p[0]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, pb := range []struct {
+		label, path, id string
+		opt             *ugarit.PageBreakOptions
+	}{
+		{"ii", "text/ch1.xhtml", "", nil},
+		{"1", "/text/ch2.xhtml", "", &ugarit.PageBreakOptions{Insert: true}},
+		{"2", "text/ch2.xhtml", "page2", &ugarit.PageBreakOptions{Insert: true, Before: "p2"}},
+	} {
+		var opt interface{}
+		if pb.opt != nil {
+			opt = pb.opt
+		}
+		if err = b.AddPageBreak(pb.label, pb.path, pb.id, opt); err != nil {
+			t.Fatalf("AddPageBreak %s: %s", pb.label, err)
+		}
+	}
+	if err = b.AddPageBreak("3", "text/ch2.xhtml", "", &ugarit.PageBreakOptions{Insert: true, Before: "nope"}); err != ugarit.ErrorElementNotFound {
+		t.Errorf("missing element: got %v", err)
+	}
+	if err = b.AddPageBreak("3", "text/ch3.xhtml", "", nil); err != ugarit.ErrorFileNotFound {
+		t.Errorf("missing file: got %v", err)
+	}
+	b.SetPageBreakSource("urn:isbn:9780306406157")
+
+	gen, err := epub30.NewIndexGenerator("TOC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.AddTOC(gen, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range br.Validate() {
+		if f.Severity >= ugarit.SeverityError {
+			t.Errorf("validate: %s", f)
+		}
+	}
+
+	md := br.Metadata()
+	if len(md.Sources) != 1 || md.Sources[0].Value != "urn:isbn:9780306406157" {
+		t.Errorf("dc:source: got %+v", md.Sources)
+	}
+	var source string
+	for _, m := range md.Meta {
+		if m.Property == "a11y:pageBreakSource" {
+			source = m.Value
+		}
+	}
+	if source != "urn:isbn:9780306406157" {
+		t.Errorf("pageBreakSource: got %q", source)
+	}
+
+	for p, wants := range map[string][]string{
+		"index.xhtml":    {`<nav epub:type="page-list" hidden="">`, `<li><a href="text/ch1.xhtml">ii</a></li><li><a href="text/ch2.xhtml#pagebreak2">1</a></li><li><a href="text/ch2.xhtml#page2">2</a></li>`},
+		"text/ch2.xhtml": {`<body><span xmlns:epub="http://www.idpf.org/2007/ops" epub:type="pagebreak" role="doc-pagebreak" id="pagebreak2" aria-label="1"></span><p>a</p><span xmlns:epub="http://www.idpf.org/2007/ops" epub:type="pagebreak" role="doc-pagebreak" id="page2" aria-label="2"></span><p id="p2">`},
+	} {
+		r, err := br.DocReader(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		for _, want := range wants {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s: %s missing in %s", p, want, data)
+			}
+		}
+	}
+}
@@ -140,6 +140,7 @@ var nav string = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
  <body>
   <nav epub:type="toc" id="toc"><ol id="TOClevel0"></ol></nav>
   <nav epub:type="landmarks"><ol id="lmarks"></ol></nav>
+  <nav epub:type="page-list" hidden=""><ol id="plist"></ol></nav>
  </body>
 </html>`
 
@@ -204,3 +205,6 @@ var rootfolder string = `<?xml version="1.0"?>
 var iBooksFonts string = `<?xml version="1.0" encoding="UTF-8"?>
 <display_options><platform name="*"><option name="specified-fonts">true</option></platform></display_options>`
 
+var iBooksFixedLayout string = `<?xml version="1.0" encoding="UTF-8"?>
+<display_options><platform name="*"><option name="specified-fonts">true</option><option name="fixed-layout">true</option></platform></display_options>`
+
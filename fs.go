@@ -0,0 +1,265 @@
+package ugarit
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BookFS is a read-only file system view of the archive of a parsed book,
+// rooted either at the archive root or at the OPF root folder. It
+// implements fs.FS, fs.ReadDirFS and fs.StatFS, so http.FileServer,
+// template.ParseFS, fs.WalkDir and the like work directly on an epub.
+// Folders not stored in the archive are synthesized from the file names.
+// Files opened from it implement io.Seeker, as http.FileServer requires.
+type BookFS struct {
+	er   *epubReader
+	root string                   // zip entry name prefix, "" for the archive root
+	dirs map[string][]fs.DirEntry // folder name -> entries sorted by name
+}
+
+// bookFile is a file opened from a BookFS. Reads are streamed from the
+// archive until the first Seek, which loads the whole file in memory.
+type bookFile struct {
+	er   *epubReader
+	f    *zip.File
+	rc   io.ReadCloser
+	rs   *bytes.Reader
+	off  int64
+	done bool
+}
+
+// bookDir is a folder opened from a BookFS.
+type bookDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+// dirInfo describes a folder of a BookFS.
+type dirInfo struct {
+	name string
+}
+
+// FS returns a file system view of the book archive, rooted at the OPF
+// folder if opfRoot is true, at the archive root otherwise.
+func (er *epubReader) FS(opfRoot bool) *BookFS {
+	var root string
+
+	if opfRoot {
+		root = er.rootFolder
+	}
+
+	bfs := &BookFS{
+		er:   er,
+		root: root,
+		dirs: map[string][]fs.DirEntry{".": nil},
+	}
+
+	for zp, f := range er.files {
+		name, ok := bfs.fsName(zp)
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(name, "/") {
+			bfs.addDir(strings.TrimSuffix(name, "/"))
+			continue
+		}
+		dir := path.Dir(name)
+		bfs.addDir(dir)
+		bfs.dirs[dir] = append(bfs.dirs[dir], fs.FileInfoToDirEntry(f.FileInfo()))
+	}
+
+	for _, entries := range bfs.dirs {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name() < entries[j].Name()
+		})
+	}
+
+	Goose.Logf(4, "FS: %d folders under %q\n", len(bfs.dirs), root)
+	return bfs
+}
+
+// fsName converts a zip entry name into a name of the file system, telling
+// whether the entry is under the root.
+func (bfs *BookFS) fsName(zp string) (string, bool) {
+	if bfs.root == "" {
+		return zp, zp != ""
+	}
+	if !strings.HasPrefix(zp, bfs.root+"/") || len(zp) == len(bfs.root)+1 {
+		return "", false
+	}
+	return zp[len(bfs.root)+1:], true
+}
+
+// zipName converts a name of the file system into a zip entry name.
+func (bfs *BookFS) zipName(name string) string {
+	if bfs.root == "" {
+		return name
+	}
+	return bfs.root + "/" + name
+}
+
+// addDir registers the folder and its parents.
+func (bfs *BookFS) addDir(name string) {
+	if _, ok := bfs.dirs[name]; ok {
+		return
+	}
+	bfs.dirs[name] = []fs.DirEntry{}
+	parent := path.Dir(name)
+	bfs.addDir(parent)
+	bfs.dirs[parent] = append(bfs.dirs[parent], fs.FileInfoToDirEntry(dirInfo{path.Base(name)}))
+}
+
+// Open opens the named file or folder.
+func (bfs *BookFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if entries, ok := bfs.dirs[name]; ok {
+		return &bookDir{info: dirInfo{path.Base(name)}, entries: entries}, nil
+	}
+
+	f, ok := bfs.er.files[bfs.zipName(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	rc, err := bfs.er.openEntry(f)
+	if err != nil {
+		Goose.Logf(1, "Open: error opening %s: %s\n", name, err)
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &bookFile{er: bfs.er, f: f, rc: rc}, nil
+}
+
+// ReadDir reads the named folder and returns its entries sorted by name.
+func (bfs *BookFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	entries, ok := bfs.dirs[name]
+	if !ok {
+		if _, ok = bfs.er.files[bfs.zipName(name)]; ok {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return append([]fs.DirEntry(nil), entries...), nil
+}
+
+// Stat returns a FileInfo describing the named file or folder.
+func (bfs *BookFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if _, ok := bfs.dirs[name]; ok {
+		return dirInfo{path.Base(name)}, nil
+	}
+
+	f, ok := bfs.er.files[bfs.zipName(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return f.FileInfo(), nil
+}
+
+func (bf *bookFile) Stat() (fs.FileInfo, error) {
+	return bf.f.FileInfo(), nil
+}
+
+func (bf *bookFile) Read(p []byte) (int, error) {
+	if bf.done {
+		return 0, fs.ErrClosed
+	}
+	if bf.rs != nil {
+		return bf.rs.Read(p)
+	}
+	n, err := bf.rc.Read(p)
+	bf.off += int64(n)
+	return n, err
+}
+
+// Seek loads the whole file on its first call, as compressed archive
+// entries can only be read sequentially.
+func (bf *bookFile) Seek(offset int64, whence int) (int64, error) {
+	if bf.done {
+		return 0, fs.ErrClosed
+	}
+
+	if bf.rs == nil {
+		rc, err := bf.er.openEntry(bf.f)
+		if err != nil {
+			return 0, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return 0, err
+		}
+		bf.rc.Close()
+		bf.rs = bytes.NewReader(data)
+		bf.rs.Seek(bf.off, io.SeekStart)
+	}
+
+	return bf.rs.Seek(offset, whence)
+}
+
+func (bf *bookFile) Close() error {
+	if bf.done {
+		return fs.ErrClosed
+	}
+	bf.done = true
+	if bf.rs != nil {
+		return nil
+	}
+	return bf.rc.Close()
+}
+
+func (bd *bookDir) Stat() (fs.FileInfo, error) {
+	return bd.info, nil
+}
+
+func (bd *bookDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: bd.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (bd *bookDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries of the folder, or all the remaining
+// ones if n <= 0.
+func (bd *bookDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := bd.entries[bd.off:]
+	if n <= 0 {
+		bd.off = len(bd.entries)
+		return append([]fs.DirEntry(nil), rest...), nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	bd.off += n
+	return append([]fs.DirEntry(nil), rest[:n]...), nil
+}
+
+func (di dirInfo) Name() string       { return di.name }
+func (di dirInfo) Size() int64        { return 0 }
+func (di dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (di dirInfo) ModTime() time.Time { return time.Time{} }
+func (di dirInfo) IsDir() bool        { return true }
+func (di dirInfo) Sys() any           { return nil }
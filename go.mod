@@ -5,8 +5,7 @@ go 1.23
 require (
 	github.com/PuerkitoBio/goquery v1.8.1
 	github.com/StefanSchroeder/Golang-Roman v1.0.0
+	github.com/andybalholm/cascadia v1.3.1
 	github.com/luisfurquim/goose v0.1.0
 	golang.org/x/net v0.17.0
 )
-
-require github.com/andybalholm/cascadia v1.3.1 // indirect
@@ -0,0 +1,206 @@
+package ugarit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// HeadingSelector is the CSS selector of the headings HeadingOptions uses
+// by default.
+const HeadingSelector = "h1, h2, h3, h4, h5, h6"
+
+// HeadingOptions configures the TOC entries the epub30 and epub20 AddPage
+// methods make from the headings of the page, nested under the page entry.
+type HeadingOptions struct {
+	Selector string // CSS selector of the headings; HeadingSelector if empty
+	Depth    int    // levels of entries added under the page entry; all of them if 0
+}
+
+// Heading is a heading found by ScanHeadings.
+type Heading struct {
+	ID    string
+	Title string
+	Level int // 1 to 6 for h1 to h6; the aria-level, or 1, for other elements
+}
+
+// HeadingNode is a heading with the headings nested under it, see
+// NestHeadings.
+type HeadingNode struct {
+	Heading
+	Children []*HeadingNode
+}
+
+// ScanHeadings lists, in document order, the elements of the XHTML page
+// matching the CSS selector, which defaults to HeadingSelector. The ones
+// without an id get a generated one, written into the page; the rest of the
+// page is kept untouched. Elements without text are left out, as are the
+// section numbers written by NumberHeading.
+func ScanHeadings(page []byte, selector string) ([]byte, []Heading, error) {
+	var sel cascadia.Selector
+	var heads []Heading
+	var stack []*html.Node
+	var n int
+	var err error
+
+	if selector == "" {
+		selector = HeadingSelector
+	}
+	sel, err = cascadia.Compile(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(page))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	// Mirrors the page as an HTML tree, for the selector to match against
+	doc := &html.Node{Type: html.DocumentNode}
+	stack = []*html.Node{doc}
+	starts := map[*html.Node]int64{}
+	ids := map[string]bool{}
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &html.Node{Type: html.ElementNode, Data: strings.ToLower(t.Name.Local)}
+			for _, a := range t.Attr {
+				if a.Name.Space == "" || a.Name.Space == "xmlns" {
+					node.Attr = append(node.Attr, html.Attribute{Key: a.Name.Local, Val: a.Value})
+				}
+			}
+			if id := epubAttr(t, "id"); id != "" {
+				ids[id] = true
+			}
+			stack[len(stack)-1].AppendChild(node)
+			stack = append(stack, node)
+			starts[node] = start
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			stack[len(stack)-1].AppendChild(&html.Node{Type: html.TextNode, Data: string(t)})
+		}
+	}
+
+	res := make([]byte, 0, len(page))
+	last := 0
+	for _, node := range cascadia.QueryAll(doc, sel) {
+		h := Heading{Title: strings.Join(strings.Fields(headingText(node)), " "), Level: 1}
+		if h.Title == "" {
+			continue
+		}
+		if len(node.Data) == 2 && node.Data[0] == 'h' && node.Data[1] >= '1' && node.Data[1] <= '6' {
+			h.Level = int(node.Data[1] - '0')
+		} else if lvl, err := strconv.Atoi(nodeAttr(node, "aria-level")); err == nil && lvl > 0 {
+			h.Level = lvl
+		}
+
+		h.ID = nodeAttr(node, "id")
+		if h.ID == "" {
+			for h.ID == "" || ids[h.ID] {
+				n++
+				h.ID = fmt.Sprintf("heading%d", n)
+			}
+			ids[h.ID] = true
+
+			// The id goes right after the element name
+			off := int(starts[node]) + 1
+			for off < len(page) && !strings.ContainsRune(" \t\r\n/>", rune(page[off])) {
+				off++
+			}
+			res = append(res, page[last:off]...)
+			res = append(res, ` id="`+h.ID+`"`...)
+			last = off
+		}
+
+		heads = append(heads, h)
+	}
+	res = append(res, page[last:]...)
+
+	return res, heads, nil
+}
+
+// NestHeadings nests the headings found by ScanHeadings following their
+// levels, down to depth levels (all of them if 0). A lone top level heading
+// starting the page is taken as the page title, which the page TOC entry
+// already stands for, so it's left out.
+func NestHeadings(heads []Heading, depth int) []*HeadingNode {
+	var roots []*HeadingNode
+	var parents []*HeadingNode
+	var levels []int
+
+	for i, h := range heads {
+		if i == 0 {
+			lone := true
+			for _, other := range heads[1:] {
+				lone = lone && other.Level > h.Level
+			}
+			if lone {
+				continue
+			}
+		}
+
+		for len(levels) > 0 && levels[len(levels)-1] >= h.Level {
+			parents, levels = parents[:len(parents)-1], levels[:len(levels)-1]
+		}
+		if depth > 0 && len(levels) >= depth {
+			continue
+		}
+
+		node := &HeadingNode{Heading: h}
+		if len(parents) == 0 {
+			roots = append(roots, node)
+		} else {
+			parent := parents[len(parents)-1]
+			parent.Children = append(parent.Children, node)
+		}
+		parents, levels = append(parents, node), append(levels, h.Level)
+	}
+
+	return roots
+}
+
+// headingText returns the text of the node, but for section numbers.
+func headingText(node *html.Node) string {
+	var s strings.Builder
+
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	if strings.Contains(" "+nodeAttr(node, "class")+" ", " "+NumberClass+" ") {
+		return ""
+	}
+	for c := node.FirstChild; c != nil; c = c.NextSibling {
+		s.WriteString(headingText(c))
+	}
+
+	return s.String()
+}
+
+// nodeAttr returns the value of the attribute of the HTML node.
+func nodeAttr(node *html.Node, name string) string {
+	for _, a := range node.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
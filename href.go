@@ -0,0 +1,32 @@
+package ugarit
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Hrefs are URLs, so the package document stores them percent-encoded,
+// while the archive entry names they point to are not. The epub30 and
+// epub20 books keep the decoded paths and only encode them when writing the
+// package document.
+
+// EscapeHref percent-encodes the path of an archive entry for use as an
+// href, keeping its '/' separators.
+func EscapeHref(name string) string {
+	return (&url.URL{Path: name}).EscapedPath()
+}
+
+// UnescapeHref decodes the path of an href, keeping its fragment, if any,
+// as it is. An href which is not a valid encoding is returned untouched.
+func UnescapeHref(href string) string {
+	var frag string
+
+	if i := strings.Index(href, "#"); i >= 0 {
+		href, frag = href[:i], href[i:]
+	}
+	if name, err := url.PathUnescape(href); err == nil {
+		href = name
+	}
+
+	return href + frag
+}
@@ -0,0 +1,202 @@
+package ugarit
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Namespaces of the RFC 4122 name based UUIDs (see UUIDv5).
+const (
+	NamespaceDNS = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	NamespaceURL = "6ba7b811-9dad-11d1-80b4-00c04fd430c8"
+	NamespaceOID = "6ba7b812-9dad-11d1-80b4-00c04fd430c8"
+)
+
+// IdentifierOptions configures the identifiers the epub30 and epub20
+// AddIdentifier methods add to the book.
+type IdentifierOptions struct {
+	ID     string // element id; a generated one if empty
+	Scheme string // "ISBN", "UUID", an ONIX code list 5 number or any other scheme; guessed from the urn: prefix if empty
+	Unique bool   // makes it the unique-identifier of the package
+}
+
+// NewID returns an id made of pfx and the first number (from 1) giving an
+// id not in used.
+func NewID(pfx string, used map[string]bool) string {
+	for n := 1; ; n++ {
+		if id := fmt.Sprintf("%s%d", pfx, n); !used[id] {
+			return id
+		}
+	}
+}
+
+// IdentifierScheme guesses the scheme of the identifier from its urn:
+// prefix: "ISBN" for urn:isbn:, "UUID" for urn:uuid:, "" otherwise.
+func IdentifierScheme(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	switch {
+	case strings.HasPrefix(id, "urn:isbn:"):
+		return "ISBN"
+	case strings.HasPrefix(id, "urn:uuid:"):
+		return "UUID"
+	}
+	return ""
+}
+
+// NormalizeISBN checks the ISBN-10 or ISBN-13 checksum and returns its
+// digits, without the urn:isbn: or ISBN prefix, hyphens and blanks. The
+// ISBN-10 check digit X is returned uppercase.
+func NormalizeISBN(isbn string) (string, error) {
+	var digits []byte
+	var sum int
+
+	isbn = strings.TrimSpace(isbn)
+	if strings.HasPrefix(strings.ToLower(isbn), "urn:isbn:") {
+		isbn = isbn[len("urn:isbn:"):]
+	}
+	if strings.HasPrefix(strings.ToUpper(isbn), "ISBN") {
+		isbn = strings.TrimLeft(isbn[len("ISBN"):], "-:")
+	}
+
+	for _, r := range isbn {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, byte(r))
+		case r == 'x' || r == 'X':
+			digits = append(digits, 'X')
+		case r == '-' || r == ' ':
+		default:
+			return "", ErrorInvalidISBN
+		}
+	}
+
+	// Only the ISBN-10 check digit may be an X
+	for i, d := range digits {
+		if d == 'X' && (len(digits) != 10 || i != 9) {
+			return "", ErrorInvalidISBN
+		}
+	}
+
+	switch len(digits) {
+	case 10:
+		for i, d := range digits {
+			v := int(d - '0')
+			if d == 'X' {
+				v = 10
+			}
+			sum += (10 - i) * v
+		}
+		if sum%11 != 0 {
+			return "", ErrorInvalidISBN
+		}
+	case 13:
+		for i, d := range digits {
+			if i%2 == 0 {
+				sum += int(d - '0')
+			} else {
+				sum += 3 * int(d-'0')
+			}
+		}
+		if sum%10 != 0 {
+			return "", ErrorInvalidISBN
+		}
+	default:
+		return "", ErrorInvalidISBN
+	}
+
+	return string(digits), nil
+}
+
+// ISBN13 returns the ISBN-13 of the ISBN-10 or ISBN-13 isbn, normalized
+// (see NormalizeISBN).
+func ISBN13(isbn string) (string, error) {
+	var sum int
+
+	isbn, err := NormalizeISBN(isbn)
+	if err != nil || len(isbn) == 13 {
+		return isbn, err
+	}
+
+	isbn = "978" + isbn[:9]
+	for i, d := range isbn {
+		if i%2 == 0 {
+			sum += int(d - '0')
+		} else {
+			sum += 3 * int(d-'0')
+		}
+	}
+
+	return isbn + string(rune('0'+(10-sum%10)%10)), nil
+}
+
+// ISBNURN returns the urn:isbn: form of the normalized isbn (see
+// NormalizeISBN).
+func ISBNURN(isbn string) (string, error) {
+	isbn, err := NormalizeISBN(isbn)
+	if err != nil {
+		return "", err
+	}
+	return "urn:isbn:" + isbn, nil
+}
+
+// UUIDURN returns the urn:uuid: form, lowercase, of the UUID, given with or
+// without the prefix.
+func UUIDURN(uuid string) (string, error) {
+	key, err := adobeKey(uuid)
+	if err != nil {
+		return "", err
+	}
+	return "urn:uuid:" + formatUUID(key), nil
+}
+
+// UUIDv5 returns, in its urn:uuid: form, the RFC 4122 version 5 UUID of
+// name in the namespace, itself a UUID (e.g. NamespaceURL). The same name
+// always gets the same UUID, so rebuilding a book keeps its identifier.
+func UUIDv5(namespace, name string) (string, error) {
+	ns, err := adobeKey(namespace)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	sum := h.Sum(nil)[:16]
+
+	sum[6] = sum[6]&0x0f | 0x50 // version 5
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return "urn:uuid:" + formatUUID(sum), nil
+}
+
+// formatUUID returns the 16 bytes of the UUID in the 8-4-4-4-12 form.
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// NormalizeIdentifier returns the identifier in the normal form of its
+// scheme, along with the scheme, guessed by IdentifierScheme if "": ISBNs
+// are checked and put in their urn:isbn: form, UUIDs in their lowercase
+// urn:uuid: form. Identifiers of other schemes are returned as they are.
+func NormalizeIdentifier(id, scheme string) (string, string, error) {
+	var err error
+
+	if scheme == "" {
+		scheme = IdentifierScheme(id)
+	}
+
+	switch strings.ToUpper(scheme) {
+	case "ISBN":
+		id, err = ISBNURN(id)
+	case "UUID":
+		id, err = UUIDURN(id)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return id, scheme, nil
+}
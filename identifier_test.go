@@ -0,0 +1,36 @@
+package ugarit_test
+
+import (
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+)
+
+func TestIdentifierHelpers(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"978-3-16-148410-0", "9783161484100"},
+		{"urn:isbn:9783161484100", "9783161484100"},
+		{"ISBN 0-306-40615-2", "0306406152"},
+		{"0-8044-2957-x", "080442957X"},
+		{"978-3-16-148410-1", ""},
+		{"0-306-40615-3", ""},
+		{"03064061X2", ""},
+		{"12345", ""},
+	} {
+		got, err := ugarit.NormalizeISBN(c.in)
+		if got != c.want || (err == nil) != (c.want != "") {
+			t.Errorf("NormalizeISBN(%q): got %q, %v", c.in, got, err)
+		}
+	}
+	if got, err := ugarit.ISBN13("0-306-40615-2"); got != "9780306406157" || err != nil {
+		t.Errorf("ISBN13: got %q, %v", got, err)
+	}
+	if got, err := ugarit.UUIDv5(ugarit.NamespaceDNS, "python.org"); got != "urn:uuid:886313e1-3b8a-5372-9b90-0c9aee199e5d" || err != nil {
+		t.Errorf("UUIDv5: got %q, %v", got, err)
+	}
+	if got, err := ugarit.UUIDURN("0A1B2C3D-4E5F-4061-8293-A4B5C6D7E8F9"); got != "urn:uuid:0a1b2c3d-4e5f-4061-8293-a4b5c6d7e8f9" || err != nil {
+		t.Errorf("UUIDURN: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,333 @@
+package ugarit
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ImportOptions configures the bulk import of a file tree into a book
+// (see the AddFS method of the epub30 and epub20 books).
+// The spine pages are, in order of precedence, the files listed in Pages,
+// the files matching Glob or every XHTML file. Pages is kept in the given
+// order, the other rules are sorted by Less.
+type ImportOptions struct {
+	Pages  []string               // spine pages, in reading order, relative to the imported root
+	Glob   string                 // path.Match pattern selecting the spine pages, relative to the imported root
+	Less   func(a, b string) bool // sorts the selected pages; lexical order if nil
+	TOC    bool                   // adds the spine pages to the TOC
+	Prefix string                 // folder of the book to import the files into
+}
+
+// ImportFile is a file found by ScanFS.
+type ImportFile struct {
+	Path     string // path in fsys
+	Href     string // path in the book, relative to the OPF folder
+	MimeType string
+	Page     bool   // the file is a spine page
+	Title    string // TOC title of pages: their <title>, first heading or file name
+}
+
+// mimeTypes maps file extensions to the EPUB core media types (and a few
+// other types commonly found in books), which mime.TypeByExtension does
+// not always know or reports differently depending on the system.
+var mimeTypes = map[string]string{
+	".xhtml": "application/xhtml+xml",
+	".xht":   "application/xhtml+xml",
+	".html":  "application/xhtml+xml",
+	".htm":   "application/xhtml+xml",
+	".css":   "text/css",
+	".js":    "application/javascript",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".mp3":   "audio/mpeg",
+	".m4a":   "audio/mp4",
+	".aac":   "audio/mp4",
+	".ogg":   "audio/ogg",
+	".opus":  "audio/opus",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+	".smil":  "application/smil+xml",
+	".ncx":   "application/x-dtbncx+xml",
+	".pls":   "application/pls+xml",
+	".xml":   "application/xml",
+	".txt":   "text/plain",
+	".vtt":   "text/vtt",
+}
+
+// MimeType detects the media type of a file from the extension of its
+// name or, when the extension is unknown, by sniffing head, the first
+// bytes of its content. HTML is reported as XHTML, the only HTML
+// serialization allowed in EPUB.
+func MimeType(name string, head []byte) string {
+	var mt string
+
+	ext := strings.ToLower(path.Ext(name))
+	if mt = mimeTypes[ext]; mt != "" {
+		return mt
+	}
+
+	if mt = mime.TypeByExtension(ext); mt != "" {
+		mt, _, _ = mime.ParseMediaType(mt)
+		return mt
+	}
+
+	mt, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	switch mt {
+	case "text/html":
+		return "application/xhtml+xml"
+	case "text/xml":
+		switch {
+		case bytes.Contains(head, []byte("<html")):
+			return "application/xhtml+xml"
+		case bytes.Contains(head, []byte("<svg")):
+			return "image/svg+xml"
+		}
+		return "application/xml"
+	}
+
+	return mt
+}
+
+// ScanFS lists the files under root in fsys to be imported in a book,
+// detecting their media types and selecting the spine pages as set by opt,
+// which may be nil. Hidden files (name starting with '.') are skipped.
+// The other files come first, in lexical order, then the pages in reading
+// order.
+func ScanFS(fsys fs.FS, root string, opt *ImportOptions) ([]ImportFile, error) {
+	var files, pages []ImportFile
+	var byPath map[string]int
+	var sel []string
+	var err error
+
+	if opt == nil {
+		opt = &ImportOptions{}
+	}
+	if root == "" {
+		root = "."
+	}
+
+	byPath = map[string]int{}
+	err = fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel := name
+		if root != "." {
+			rel = strings.TrimPrefix(name, root+"/")
+		}
+
+		mt, err := scanMimeType(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		byPath[rel] = len(files)
+		files = append(files, ImportFile{
+			Path:     name,
+			Href:     path.Join(opt.Prefix, rel),
+			MimeType: mt,
+		})
+		return nil
+	})
+	if err != nil {
+		Goose.Logf(1, "ScanFS: error walking %s: %s\n", root, err)
+		return nil, err
+	}
+
+	if len(opt.Pages) > 0 {
+		sel = opt.Pages
+	} else {
+		for rel, i := range byPath {
+			if opt.Glob != "" {
+				if ok, err := path.Match(opt.Glob, rel); err != nil {
+					return nil, err
+				} else if !ok {
+					continue
+				}
+			} else if files[i].MimeType != "application/xhtml+xml" {
+				continue
+			}
+			sel = append(sel, rel)
+		}
+		if opt.Less != nil {
+			sort.Slice(sel, func(i, j int) bool { return opt.Less(sel[i], sel[j]) })
+		} else {
+			sort.Strings(sel)
+		}
+	}
+
+	for _, rel := range sel {
+		i, ok := byPath[path.Clean(rel)]
+		if !ok || files[i].Page {
+			Goose.Logf(1, "ScanFS: page not found or listed twice: %s\n", rel)
+			return nil, ErrorFileNotFound
+		}
+		files[i].Page = true
+		if opt.TOC {
+			files[i].Title, err = scanTitle(fsys, files[i].Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+		pages = append(pages, files[i])
+	}
+
+	res := make([]ImportFile, 0, len(files))
+	for _, f := range files {
+		if !f.Page {
+			res = append(res, f)
+		}
+	}
+	res = append(res, pages...)
+
+	Goose.Logf(3, "ScanFS: %d files, %d pages under %s\n", len(res), len(pages), root)
+	return res, nil
+}
+
+// AddFS adds to the book every file under root in fsys, as listed by ScanFS,
+// which opt configures. The pages go through AddPage, with the options
+// pageOptions returns for them (given their title if opt.TOC is set, ""
+// otherwise), the other files through AddFile. It backs the AddFS method of
+// the epub30 and epub20 books.
+func AddFS(b Book, fsys fs.FS, root string, opt *ImportOptions, pageOptions func(title string) interface{}) error {
+	files, err := ScanFS(fsys, root, opt)
+	if err != nil {
+		return err
+	}
+
+	for _, imp := range files {
+		f, err := fsys.Open(imp.Path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case imp.Page && opt != nil && opt.TOC:
+			_, _, _, err = b.AddPage(imp.Href, imp.MimeType, f, "", pageOptions(imp.Title))
+		case imp.Page:
+			_, _, _, err = b.AddPage(imp.Href, imp.MimeType, f, "", pageOptions(""))
+		default:
+			_, _, err = b.AddFile(imp.Href, imp.MimeType, f, "", nil)
+		}
+		f.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanMimeType detects the media type of the named file, sniffing its
+// first bytes.
+func scanMimeType(fsys fs.FS, name string) (string, error) {
+	var head [512]byte
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	n, err := io.ReadFull(f, head[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return MimeType(name, head[:n]), nil
+}
+
+// scanTitle returns the <title> of the named page, its first heading or,
+// lacking both, its file name without extension.
+func scanTitle(fsys fs.FS, name string) (string, error) {
+	var title, heading string
+	var walk func(*html.Node)
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	doc, err := html.Parse(f)
+	if err != nil {
+		return "", err
+	}
+
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if title == "" {
+					title = strings.TrimSpace(nodeText(n))
+				}
+				return
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				if heading == "" {
+					heading = strings.TrimSpace(nodeText(n))
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	switch {
+	case title != "":
+		return title, nil
+	case heading != "":
+		return heading, nil
+	}
+
+	base := path.Base(name)
+	return strings.TrimSuffix(base, path.Ext(base)), nil
+}
+
+// nodeText returns the text content of n.
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
@@ -0,0 +1,156 @@
+// Package testutil holds the fixtures shared by the tests of the ugarit,
+// epub30 and epub20 packages.
+package testutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+)
+
+// Container points to the package document of Epub.
+const Container = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+ <rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`
+
+// OPF is the package document of Epub.
+const OPF = `<?xml version="1.0" encoding="UTF-8"?>
+<package version="3.0" xmlns="http://www.idpf.org/2007/opf" xmlns:opf="http://www.idpf.org/2007/opf" unique-identifier="uid">
+ <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <dc:title id="t1">The Subtitle</dc:title>
+  <dc:title id="t2" xml:lang="en">The Title</dc:title>
+  <meta refines="#t2" property="title-type">main</meta>
+  <dc:identifier id="isbn">urn:isbn:9780306406157</dc:identifier>
+  <dc:identifier id="uid">urn:uuid:1b4e28ba-2fa1-11d2-883f-0016d3cca427</dc:identifier>
+  <meta refines="#isbn" property="identifier-type" scheme="onix:codelist5">15</meta>
+  <dc:language>en</dc:language>
+  <dc:creator id="c1">Jane Doe</dc:creator>
+  <meta refines="#c1" property="role" scheme="marc:relators" id="r1">aut</meta>
+  <meta refines="#c1" property="file-as">Doe, Jane</meta>
+  <meta refines="#r1" property="alternate-script" xml:lang="ja">著者</meta>
+  <dc:contributor opf:role="ill" opf:file-as="Roe, Richard">Richard Roe</dc:contributor>
+  <dc:subject>Fiction</dc:subject>
+  <dc:description>A test book.</dc:description>
+  <dc:rights>Public domain</dc:rights>
+  <dc:date opf:event="publication">2020-01-01</dc:date>
+  <meta property="dcterms:modified">2020-01-02T00:00:00Z</meta>
+  <meta name="cover" content="img"/>
+ </metadata>
+ <manifest>
+  <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+  <item id="ch1" href="text/ch1.xhtml" media-type="application/xhtml+xml"/>
+  <item id="img" href="img/cover.png" media-type="image/png" properties="cover-image"/>
+ </manifest>
+ <spine page-progression-direction="rtl">
+  <itemref idref="ch1" id="s1" properties="page-spread-right rendition:layout-pre-paginated"/>
+  <itemref idref="missing"/>
+  <itemref idref="nav" linear="no"/>
+ </spine>
+</package>`
+
+// Nav is the navigation document of Epub.
+const Nav = `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>TOC</title></head>
+<body>
+ <nav epub:type="toc"><ol>
+  <li><a href="text/ch1.xhtml" id="n1">Chapter 1</a><ol>
+   <li><a href="text/ch1.xhtml#s1">Section 1.1</a></li>
+   <li><span>Section 1.2</span><ol><li><a href="http://example.com/x">External</a></li></ol></li>
+  </ol></li>
+ </ol></nav>
+ <nav epub:type="landmarks"><ol><li><a href="img/cover.png" epub:type="cover">Cover</a></li></ol></nav>
+</body>
+</html>`
+
+// Chapter is an XHTML page with a single heading.
+const Chapter = `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Ch1</title></head><body><h1>Chapter 1</h1></body></html>`
+
+// MkEpub builds an in-memory epub archive holding the given files, after
+// the mimetype entry.
+func MkEpub(t *testing.T, files [][2]string) []byte {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("application/epub+zip"))
+
+	for _, f := range files {
+		w, err = zw.Create(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f[1]))
+	}
+
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// ZipEntry reads, as stored, the archive entry whose name ends with suffix.
+func ZipEntry(t *testing.T, data []byte, suffix string) []byte {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, suffix) {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			b, _ := io.ReadAll(rc)
+			return b
+		}
+	}
+	t.Fatalf("%s not in archive", suffix)
+	return nil
+}
+
+// BufCloser collects a generated book in memory.
+type BufCloser struct {
+	bytes.Buffer
+}
+
+func (BufCloser) Close() error {
+	return nil
+}
+
+// FailWriter fails every write.
+type FailWriter struct{}
+
+func (FailWriter) Write([]byte) (int, error) { return 0, io.ErrShortWrite }
+func (FailWriter) Close() error              { return nil }
+
+// Epub is a small epub 3 book with a nav document, a chapter and a cover.
+func Epub(t *testing.T) []byte {
+	return MkEpub(t, [][2]string{
+		{"META-INF/container.xml", Container},
+		{"OEBPS/content.opf", OPF},
+		{"OEBPS/nav.xhtml", Nav},
+		{"OEBPS/text/ch1.xhtml", Chapter},
+		{"OEBPS/img/cover.png", "PNG"},
+	})
+}
+
+// Book reads Epub.
+func Book(t *testing.T) ugarit.BookReader {
+	br, err := ugarit.NewReader(bytes.NewReader(Epub(t)))
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	return br
+}
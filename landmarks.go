@@ -0,0 +1,186 @@
+package ugarit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// LandmarkGenerator is implemented by the index generators able to list the
+// landmarks of the book, the pages with a semantic role (see EPubOptions
+// Landmark of the epub30 and epub20 books). AddTOC passes them the cover
+// and the pages with a role.
+type LandmarkGenerator interface {
+	// AddLandmark must append the page at href, having the epub:type role,
+	// to the landmarks, labeled label.
+	AddLandmark(href, epubType, label string)
+}
+
+// landmarkRoles maps the landmark roles (EPUB 3 structural semantics) to
+// their EPUB 2 guide types and default labels.
+var landmarkRoles = map[string]struct{ guide, label string }{
+	"cover":           {"cover", "Cover"},
+	"titlepage":       {"title-page", "Title Page"},
+	"toc":             {"toc", "Table of Contents"},
+	"frontmatter":     {"other.frontmatter", "Front Matter"},
+	"bodymatter":      {"text", "Start"},
+	"backmatter":      {"other.backmatter", "Back Matter"},
+	"copyright-page":  {"copyright-page", "Copyright"},
+	"dedication":      {"dedication", "Dedication"},
+	"epigraph":        {"epigraph", "Epigraph"},
+	"foreword":        {"foreword", "Foreword"},
+	"preface":         {"preface", "Preface"},
+	"acknowledgments": {"acknowledgements", "Acknowledgements"},
+	"appendix":        {"other.appendix", "Appendix"},
+	"bibliography":    {"bibliography", "Bibliography"},
+	"glossary":        {"glossary", "Glossary"},
+	"index":           {"index", "Index"},
+	"endnotes":        {"notes", "Notes"},
+	"colophon":        {"colophon", "Colophon"},
+	"loi":             {"loi", "List of Illustrations"},
+	"lot":             {"lot", "List of Tables"},
+}
+
+var epubTypeAttr = regexp.MustCompile(`\sepub:type\s*=\s*("[^"]*"|'[^']*')`)
+
+// LandmarkRole returns the EPUB 3 role of a landmark given either its role
+// or its EPUB 2 guide type, e.g. "titlepage" for "title-page". Unknown
+// roles are returned as they are, without the "other." guide prefix.
+func LandmarkRole(role string) string {
+	if _, ok := landmarkRoles[role]; ok {
+		return role
+	}
+	for r, l := range landmarkRoles {
+		if l.guide == role {
+			return r
+		}
+	}
+	return strings.TrimPrefix(role, "other.")
+}
+
+// GuideType returns the EPUB 2 guide type of the landmark role, e.g.
+// "title-page" for "titlepage". Roles with no guide type of their own are
+// returned as "other." types.
+func GuideType(role string) string {
+	role = LandmarkRole(role)
+	if l, ok := landmarkRoles[role]; ok {
+		return l.guide
+	}
+	return "other." + role
+}
+
+// LandmarkLabel returns the default label of the landmark role, or the role
+// itself if it has none.
+func LandmarkLabel(role string) string {
+	if l, ok := landmarkRoles[LandmarkRole(role)]; ok {
+		return l.label
+	}
+	return role
+}
+
+// InsertEpubType adds role to the epub:type of the XHTML page body or, if
+// the body only holds a section, of this section. The rest of the page is
+// kept untouched.
+func InsertEpubType(page []byte, role string) ([]byte, error) {
+	var stack []bool         // open elements, whether they declare the epub namespace
+	var body, child [2]int64 // start and end offsets of the tags
+	var bodyNS, childNS, inBody bool
+	var children, depth int
+	var childName string
+
+	dec := xml.NewDecoder(bytes.NewReader(page))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	declared := func() bool {
+		for _, decl := range stack {
+			if decl {
+				return true
+			}
+		}
+		return false
+	}
+
+	body[0] = -1
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			decl := false
+			for _, a := range t.Attr {
+				decl = decl || (a.Name.Space == "xmlns" && a.Name.Local == "epub")
+			}
+			stack = append(stack, decl)
+			switch {
+			case body[0] < 0 && t.Name.Local == "body":
+				body, bodyNS, inBody = [2]int64{start, dec.InputOffset()}, declared(), true
+				depth = len(stack)
+			case inBody && len(stack) == depth+1:
+				children++
+				if children == 1 {
+					child, childNS, childName = [2]int64{start, dec.InputOffset()}, declared(), t.Name.Local
+				}
+			}
+		case xml.EndElement:
+			if inBody && len(stack) == depth {
+				inBody = false
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	if body[0] < 0 {
+		Goose.Logf(1, "InsertEpubType: no body for the %s role\n", role)
+		return nil, ErrorElementNotFound
+	}
+	if children == 1 && childName == "section" {
+		body, bodyNS = child, childNS
+	}
+
+	tag := string(page[body[0]:body[1]])
+	if m := epubTypeAttr.FindStringSubmatchIndex(tag); m != nil {
+		// The role joins the ones already there
+		val := tag[m[2]+1 : m[3]-1]
+		for _, r := range strings.Fields(val) {
+			if r == role {
+				return page, nil
+			}
+		}
+		tag = tag[:m[2]+1] + strings.TrimSpace(val+" "+role) + tag[m[3]-1:]
+	} else {
+		var attr bytes.Buffer
+		if !bodyNS {
+			attr.WriteString(` xmlns:epub="http://www.idpf.org/2007/ops"`)
+		}
+		attr.WriteString(` epub:type="`)
+		xml.EscapeText(&attr, []byte(role))
+		attr.WriteString(`"`)
+
+		// The attribute goes right after the element name
+		off := 1
+		for off < len(tag) && !strings.ContainsRune(" \t\r\n/>", rune(tag[off])) {
+			off++
+		}
+		tag = tag[:off] + attr.String() + tag[off:]
+	}
+
+	res := make([]byte, 0, len(page)+len(tag))
+	res = append(res, page[:body[0]]...)
+	res = append(res, tag...)
+	res = append(res, page[body[1]:]...)
+
+	return res, nil
+}
@@ -0,0 +1,108 @@
+package ugarit
+
+import (
+	"strings"
+)
+
+// Manifest is the view of a book manifest the file operations shared by the
+// epub30 and epub20 books work on. Items are addressed by their position.
+type Manifest interface {
+	Len() int
+	Href(n int) string
+
+	// RenameItem changes the href of the Nth item, updating the references
+	// to it.
+	RenameItem(n int, href string)
+
+	// RemoveItem removes the Nth item along with its contents and the
+	// references to it.
+	RemoveItem(n int)
+}
+
+// RelPath returns path relative to the root folder, as manifest hrefs are.
+func RelPath(path string) string {
+	return strings.TrimLeft(path, "/")
+}
+
+// LookupFile returns the position of the file at path in m, or -1.
+func LookupFile(m Manifest, path string) int {
+	path = RelPath(path)
+	for i := 0; i < m.Len(); i++ {
+		if RelPath(m.Href(i)) == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// RemoveFile removes the file at path from m.
+func RemoveFile(m Manifest, path string) error {
+	n := LookupFile(m, path)
+	if n < 0 {
+		return ErrorFileNotFound
+	}
+
+	m.RemoveItem(n)
+
+	return nil
+}
+
+// RemoveAllFiles removes path and any files under it from m. If the path
+// does not exist, it returns nil (no error).
+func RemoveAllFiles(m Manifest, path string) error {
+	var dir string
+
+	path = RelPath(path)
+	if path != "" {
+		dir = strings.TrimSuffix(path, "/") + "/"
+	}
+
+	for i := 0; i < m.Len(); {
+		if href := RelPath(m.Href(i)); href == path || strings.HasPrefix(href, dir) {
+			m.RemoveItem(i)
+			continue
+		}
+		i++
+	}
+
+	return nil
+}
+
+// RenameFile renames (moves) oldpath to newpath in m. If oldpath is a
+// folder, every file under it is moved. Renaming onto a file of m or onto a
+// reserved path fails.
+func RenameFile(m Manifest, oldpath, newpath string) error {
+	var moves map[int]string
+
+	oldpath, newpath = RelPath(oldpath), RelPath(newpath)
+	if newpath == "" || newpath == "index.html" || newpath == "content.opf" {
+		return ErrorInvalidPathname
+	}
+
+	moves = map[int]string{}
+	for i := 0; i < m.Len(); i++ {
+		href := RelPath(m.Href(i))
+		switch {
+		case href == oldpath:
+			moves[i] = newpath
+		case strings.HasPrefix(href, oldpath+"/"):
+			moves[i] = newpath + href[len(oldpath):]
+		}
+	}
+
+	if len(moves) == 0 {
+		return ErrorFileNotFound
+	}
+
+	for _, href := range moves {
+		if LookupFile(m, href) >= 0 {
+			return ErrorFileExists
+		}
+	}
+
+	for i, href := range moves {
+		m.RenameItem(i, href)
+	}
+
+	return nil
+}
@@ -0,0 +1,326 @@
+package ugarit
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Namespaces recognized when parsing the OPF <metadata> block.
+const (
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsXML = "http://www.w3.org/XML/1998/namespace"
+)
+
+// Metadata holds the package metadata of an epub, as declared in the
+// <metadata> block of its OPF document.
+type Metadata struct {
+	Version          string // package version attribute ("2.0", "3.0"...)
+	UniqueIdentifier string // id of the dc:identifier named by the package
+	Prefix           string // package prefix attribute, declaring metadata vocabularies
+
+	Titles       []MetaValue
+	Languages    []MetaValue
+	Identifiers  []Identifier
+	Creators     []Person
+	Contributors []Person
+	Publishers   []MetaValue
+	Dates        []Date
+	Subjects     []MetaValue
+	Descriptions []MetaValue
+	Rights       []MetaValue
+	Sources      []MetaValue
+	Relations    []MetaValue
+	Coverages    []MetaValue
+	Types        []MetaValue
+	Formats      []MetaValue
+
+	// Collections lists the series and sets the book belongs to.
+	Collections []Collection
+
+	// Meta lists every <meta> entry in document order, each one with
+	// the entries refining it already attached.
+	Meta []Meta
+}
+
+// MetaValue is one Dublin Core element of the package metadata.
+type MetaValue struct {
+	ID    string
+	Value string
+	Lang  string
+	Dir   string
+
+	// Refinements holds the EPUB 3 <meta refines="#ID"> entries
+	// targeting this element.
+	Refinements []Meta
+}
+
+// Identifier is a dc:identifier element.
+type Identifier struct {
+	MetaValue
+	Scheme string // opf:scheme (EPUB 2) or identifier-type refinement (EPUB 3)
+}
+
+// Person is a dc:creator or dc:contributor element.
+type Person struct {
+	MetaValue
+	Role   string // opf:role (EPUB 2) or role refinement (EPUB 3)
+	FileAs string // opf:file-as (EPUB 2) or file-as refinement (EPUB 3)
+}
+
+// Date is a dc:date element.
+type Date struct {
+	MetaValue
+	Event string // opf:event (EPUB 2 only)
+}
+
+// Meta is a <meta> entry. EPUB 3 entries use Property/Value, EPUB 2
+// entries use Name/Content.
+type Meta struct {
+	ID       string
+	Property string
+	Refines  string // raw refines attribute, e.g. "#creator01"
+	Scheme   string
+	Lang     string
+	Name     string
+	Content  string
+	Value    string
+
+	// Refinements holds the entries refining this one, so chains
+	// like a role refining a creator refining a title are kept.
+	Refinements []Meta
+}
+
+// Refinement returns the value of the first refinement with the given
+// property, or "" if there is none.
+func (mv MetaValue) Refinement(name string) string {
+	return epubRefinement(mv.Refinements, name)
+}
+
+// Refinement returns the value of the first refinement with the given
+// property, or "" if there is none.
+func (m Meta) Refinement(name string) string {
+	return epubRefinement(m.Refinements, name)
+}
+
+// Title returns the main title of the book: the one refined with
+// title-type "main" if any, the first one otherwise.
+func (m Metadata) Title() string {
+	for _, t := range m.Titles {
+		if t.Refinement("title-type") == "main" {
+			return t.Value
+		}
+	}
+	if len(m.Titles) > 0 {
+		return m.Titles[0].Value
+	}
+	return ""
+}
+
+// Identifier returns the identifier named by the package
+// unique-identifier attribute, falling back to the first one.
+func (m Metadata) Identifier() Identifier {
+	for _, id := range m.Identifiers {
+		if id.ID != "" && id.ID == m.UniqueIdentifier {
+			return id
+		}
+	}
+	if len(m.Identifiers) > 0 {
+		return m.Identifiers[0]
+	}
+	return Identifier{}
+}
+
+// --- internal XML structures for metadata parsing ---
+
+type epubOPFMetadata struct {
+	Elements []epubOPFMetaElem `xml:",any"`
+}
+
+type epubOPFMetaElem struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Value   string     `xml:",chardata"`
+}
+
+// attr returns the value of the attribute with the given local name,
+// regardless of its namespace (opf:role and role are both accepted).
+func (el epubOPFMetaElem) attr(local string) string {
+	for _, a := range el.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// lang returns the xml:lang attribute of the element.
+func (el epubOPFMetaElem) lang() string {
+	for _, a := range el.Attrs {
+		if a.Name.Local == "lang" && (a.Name.Space == nsXML || a.Name.Space == "xml") {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// epubBuildMetadata converts the raw <metadata> elements into a Metadata,
+// attaching every refines chain to its target.
+func epubBuildMetadata(pkg *epubOPFPackage) Metadata {
+	var md Metadata
+	var metas []Meta
+
+	md.Version = pkg.Version
+	md.UniqueIdentifier = pkg.UniqueIdentifier
+	md.Prefix = pkg.Prefix
+
+	// First pass: collect the <meta> entries, so DC elements can be
+	// refined by entries appearing after them.
+	for _, el := range pkg.Metadata.Elements {
+		if el.XMLName.Local != "meta" || epubIsDC(el.XMLName.Space) {
+			continue
+		}
+		metas = append(metas, Meta{
+			ID:       el.attr("id"),
+			Property: el.attr("property"),
+			Refines:  el.attr("refines"),
+			Scheme:   el.attr("scheme"),
+			Lang:     el.lang(),
+			Name:     el.attr("name"),
+			Content:  el.attr("content"),
+			Value:    strings.TrimSpace(el.Value),
+		})
+	}
+
+	// children maps an element id to the indices of the metas refining it.
+	children := map[string][]int{}
+	for i, m := range metas {
+		if target := epubRefinesTarget(m.Refines); target != "" {
+			children[target] = append(children[target], i)
+		}
+	}
+
+	refinements := func(id string) []Meta {
+		if id == "" {
+			return nil
+		}
+		return epubResolveRefines(metas, children, id, map[string]bool{})
+	}
+
+	for i := range metas {
+		m := metas[i]
+		m.Refinements = refinements(m.ID)
+		md.Meta = append(md.Meta, m)
+	}
+
+	for _, el := range pkg.Metadata.Elements {
+		if !epubIsDC(el.XMLName.Space) {
+			continue
+		}
+
+		mv := MetaValue{
+			ID:    el.attr("id"),
+			Value: strings.TrimSpace(el.Value),
+			Lang:  el.lang(),
+			Dir:   el.attr("dir"),
+		}
+		mv.Refinements = refinements(mv.ID)
+
+		Goose.Logf(5, "epubBuildMetadata: dc:%s id=%q value=%q\n", el.XMLName.Local, mv.ID, mv.Value)
+
+		switch el.XMLName.Local {
+		case "title":
+			md.Titles = append(md.Titles, mv)
+		case "language":
+			md.Languages = append(md.Languages, mv)
+		case "identifier":
+			id := Identifier{MetaValue: mv, Scheme: el.attr("scheme")}
+			if id.Scheme == "" {
+				id.Scheme = mv.Refinement("identifier-type")
+			}
+			md.Identifiers = append(md.Identifiers, id)
+		case "creator", "contributor":
+			p := Person{MetaValue: mv, Role: el.attr("role"), FileAs: el.attr("file-as")}
+			if p.Role == "" {
+				p.Role = mv.Refinement("role")
+			}
+			if p.FileAs == "" {
+				p.FileAs = mv.Refinement("file-as")
+			}
+			if el.XMLName.Local == "creator" {
+				md.Creators = append(md.Creators, p)
+			} else {
+				md.Contributors = append(md.Contributors, p)
+			}
+		case "publisher":
+			md.Publishers = append(md.Publishers, mv)
+		case "date":
+			md.Dates = append(md.Dates, Date{MetaValue: mv, Event: el.attr("event")})
+		case "subject":
+			md.Subjects = append(md.Subjects, mv)
+		case "description":
+			md.Descriptions = append(md.Descriptions, mv)
+		case "rights":
+			md.Rights = append(md.Rights, mv)
+		case "source":
+			md.Sources = append(md.Sources, mv)
+		case "relation":
+			md.Relations = append(md.Relations, mv)
+		case "coverage":
+			md.Coverages = append(md.Coverages, mv)
+		case "type":
+			md.Types = append(md.Types, mv)
+		case "format":
+			md.Formats = append(md.Formats, mv)
+		}
+	}
+
+	md.Collections = epubCollections(md.Meta)
+
+	return md
+}
+
+// epubResolveRefines returns the metas refining id, each one carrying its
+// own refinements. seen breaks malicious or broken refines cycles.
+func epubResolveRefines(metas []Meta, children map[string][]int, id string, seen map[string]bool) []Meta {
+	var res []Meta
+
+	if seen[id] {
+		Goose.Logf(1, "epubResolveRefines: refines cycle through #%s\n", id)
+		return nil
+	}
+	seen[id] = true
+	defer delete(seen, id)
+
+	for _, i := range children[id] {
+		m := metas[i]
+		if m.ID != "" {
+			m.Refinements = epubResolveRefines(metas, children, m.ID, seen)
+		}
+		res = append(res, m)
+	}
+
+	return res
+}
+
+// epubRefinesTarget extracts the target id from a refines attribute.
+func epubRefinesTarget(refines string) string {
+	if i := strings.LastIndex(refines, "#"); i >= 0 {
+		return refines[i+1:]
+	}
+	return ""
+}
+
+func epubRefinement(refinements []Meta, name string) string {
+	for _, m := range refinements {
+		if m.Property == name {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+// epubIsDC tells if an element namespace is Dublin Core. The bare "dc"
+// prefix is accepted for documents that forget to declare it.
+func epubIsDC(space string) bool {
+	return space == nsDC || space == "dc"
+}
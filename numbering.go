@@ -0,0 +1,164 @@
+package ugarit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// NumberClass is the class of the span holding the section number that
+// NumberHeading writes into the page heading, so the book CSS can style it.
+const NumberClass = "section-number"
+
+// NumberHeading writes number into the first heading (h1 to h6) of the
+// XHTML page found at or inside the element whose id is fragment or, if
+// fragment is "", inside the body. The number is held by a span of class
+// NumberClass put at the start of the heading; a span left by a previous
+// call is replaced. The rest of the page is kept untouched.
+func NumberHeading(page []byte, fragment, number string) ([]byte, error) {
+	var span bytes.Buffer
+	var inside bool
+	var start, end int64
+
+	dec := xml.NewDecoder(bytes.NewReader(page))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	isHeading := func(name string) bool {
+		name = strings.ToLower(name)
+		return len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6'
+	}
+
+	// Looks for the heading
+	start = -1
+	for start < 0 {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			Goose.Logf(1, "NumberHeading: no heading for the section %s at %q\n", number, fragment)
+			return nil, ErrorElementNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		t, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !inside {
+			if fragment == "" {
+				inside = t.Name.Local == "body"
+				continue
+			}
+			for _, a := range t.Attr {
+				if a.Name.Space == "" && a.Name.Local == "id" && a.Value == fragment {
+					inside = true
+				}
+			}
+		}
+		if inside && isHeading(t.Name.Local) {
+			start = dec.InputOffset()
+		}
+	}
+
+	// A previous number is dropped, along with its separator
+	end = start
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := tok.(xml.StartElement); ok && t.Name.Local == "span" && epubAttr(t, "class") == NumberClass {
+		err = dec.Skip()
+		if err != nil {
+			return nil, err
+		}
+		end = dec.InputOffset()
+		if end < int64(len(page)) && page[end] == ' ' {
+			end++
+		}
+	}
+
+	span.WriteString(`<span class="` + NumberClass + `">`)
+	xml.EscapeText(&span, []byte(number))
+	span.WriteString(`</span> `)
+
+	res := make([]byte, 0, len(page)+span.Len())
+	res = append(res, page[:start]...)
+	res = append(res, span.Bytes()...)
+	res = append(res, page[end:]...)
+
+	return res, nil
+}
+
+// Section is the view of a TOC entry NumberSections works on, provided by
+// the epub30 and epub20 books.
+type Section interface {
+	Subsections() []Section
+
+	// SubsectionStyle returns the style the entry numbers its subsections
+	// with, nil if it has none.
+	SubsectionStyle() SectionStyle
+
+	// SetNumber sets the section number the TOC label is preceded by.
+	SetNumber(number string)
+
+	// Page returns the contents of the XHTML page the entry points to and
+	// the id of the element inside it, if any. A nil page means there is no
+	// page to number.
+	Page() (page []byte, fragment string, err error)
+
+	// SetPage replaces the contents of the page the entry points to.
+	SetPage(page []byte) error
+}
+
+// NumberSections numbers the TOC sections with sty, under the parent
+// section number root. Subsections are numbered with their own style or, if
+// they have none, with the style of their parent. With headings set, the
+// numbers are also written into the page headings (see NumberHeading).
+func NumberSections(sections []Section, sty SectionStyle, root string, headings bool) error {
+	for i, s := range sections {
+		var n, number string
+
+		if sty != nil {
+			n = sty.Number(root, i+1)
+			number = strings.TrimSpace(sty.Prefix() + " " + n)
+		}
+		s.SetNumber(number)
+		if headings && number != "" {
+			if err := numberSection(s, number); err != nil {
+				return err
+			}
+		}
+
+		sub := s.SubsectionStyle()
+		if sub == nil {
+			sub = sty
+		}
+		if err := NumberSections(s.Subsections(), sub, n, headings); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// numberSection writes the section number into the heading of the page of
+// s. Pages without a heading are left as they are.
+func numberSection(s Section, number string) error {
+	page, fragment, err := s.Page()
+	if err != nil || page == nil {
+		return err
+	}
+
+	page, err = NumberHeading(page, fragment, number)
+	if err == ErrorElementNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.SetPage(page)
+}
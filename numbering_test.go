@@ -0,0 +1,27 @@
+package ugarit_test
+
+import (
+	"testing"
+
+	"github.com/luisfurquim/ugarit"
+)
+
+func TestSectionStyles(t *testing.T) {
+	for _, c := range []struct {
+		sty  ugarit.SectionStyle
+		n    int
+		want string
+	}{
+		{ugarit.NewArabicNumbering("", true), 3, "3"},
+		{ugarit.NewUpperLetterNumbering("", false), 1, "A"},
+		{ugarit.NewLowerLetterNumbering("", true), 2, "b"},
+		{ugarit.NewUpperRomanNumbering("", true), 4, "IV"},
+	} {
+		if got := c.sty.Number("", c.n); got != c.want {
+			t.Errorf("Number(%q, %d): got %q, want %q", "", c.n, got, c.want)
+		}
+	}
+	if got := ugarit.NewLowerRomanNumbering("", true).Number("2.a", 3); got != "2.a.iii" {
+		t.Errorf("hierarchical number: got %q", got)
+	}
+}
@@ -0,0 +1,212 @@
+package ugarit
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// The font obfuscation algorithms, as named in META-INF/encryption.xml.
+const (
+	ObfuscationIDPF  = "http://www.idpf.org/2008/embedding"
+	ObfuscationAdobe = "http://ns.adobe.com/pdf/enc#RC"
+)
+
+// FontOptions configures the AddFont method of the epub30 and epub20 books.
+type FontOptions struct {
+	// Obfuscation is the algorithm the font is obfuscated with when the
+	// book is saved: ObfuscationIDPF, ObfuscationAdobe or "" for none.
+	Obfuscation string
+}
+
+// fontTypes maps the font file extensions to their EPUB 3 media types and
+// to the ones EPUB 2 reading systems know.
+var fontTypes = map[string][2]string{
+	".otf":   {"font/otf", "application/vnd.ms-opentype"},
+	".ttf":   {"font/ttf", "application/x-font-truetype"},
+	".woff":  {"font/woff", "application/font-woff"},
+	".woff2": {"font/woff2", "font/woff2"},
+}
+
+// Check returns ErrorUnknownObfuscation if the algorithm is not one of the
+// supported ones.
+func (o FontOptions) Check() error {
+	switch o.Obfuscation {
+	case "", ObfuscationIDPF, ObfuscationAdobe:
+		return nil
+	}
+	return ErrorUnknownObfuscation
+}
+
+// FontMediaType returns the media type of the font file its extension
+// (.otf, .ttf, .woff or .woff2) tells: the EPUB 3 one or, if legacy is
+// set, the one EPUB 2 reading systems know.
+func FontMediaType(name string, legacy bool) (string, error) {
+	t, ok := fontTypes[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return "", ErrorUnknownFontType
+	}
+	if legacy {
+		return t[1], nil
+	}
+	return t[0], nil
+}
+
+// ObfuscateFont obfuscates (or de-obfuscates) the font data with the
+// algorithm, keyed on the book identifiers (see ObfuscationKey). The unique
+// identifier defaults to the first of ids.
+func ObfuscateFont(data []byte, algorithm, uniqueID string, ids []string) ([]byte, error) {
+	if uniqueID == "" && len(ids) > 0 {
+		uniqueID = ids[0]
+	}
+
+	key, err := ObfuscationKey(algorithm, uniqueID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return Obfuscate(data, algorithm, key)
+}
+
+// EncryptedFile is an entry of META-INF/encryption.xml.
+type EncryptedFile struct {
+	URI       string // path of the file in the archive
+	Algorithm string
+}
+
+type epubEncryption struct {
+	Data []struct {
+		Method struct {
+			Algorithm string `xml:"Algorithm,attr"`
+		} `xml:"EncryptionMethod"`
+		Ref struct {
+			URI string `xml:"URI,attr"`
+		} `xml:"CipherData>CipherReference"`
+	} `xml:"EncryptedData"`
+}
+
+// ObfuscationKey returns the key the algorithm obfuscates fonts with: the
+// book unique identifier, for ObfuscationIDPF, or the first UUID among the
+// unique identifier and the other ids, for ObfuscationAdobe.
+func ObfuscationKey(algorithm, uniqueID string, ids []string) (string, error) {
+	switch algorithm {
+	case ObfuscationIDPF:
+		return uniqueID, nil
+	case ObfuscationAdobe:
+		for _, id := range append([]string{uniqueID}, ids...) {
+			if _, err := adobeKey(id); err == nil {
+				return id, nil
+			}
+		}
+		return "", ErrorInvalidUUID
+	}
+
+	return "", ErrorUnknownObfuscation
+}
+
+// Obfuscate XORs the start of the font data with the key (see
+// ObfuscationKey): the first 1040 bytes with the SHA-1 of the key, without
+// blanks, for ObfuscationIDPF; the first 1024 bytes with the 16 bytes of the
+// key UUID, for ObfuscationAdobe. Being a XOR, it also de-obfuscates. The
+// data is left untouched; the result is a copy.
+func Obfuscate(data []byte, algorithm, key string) ([]byte, error) {
+	var mask []byte
+	var n int
+
+	switch algorithm {
+	case ObfuscationIDPF:
+		sum := sha1.Sum([]byte(strings.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, key)))
+		mask, n = sum[:], 1040
+	case ObfuscationAdobe:
+		uuid, err := adobeKey(key)
+		if err != nil {
+			return nil, err
+		}
+		mask, n = uuid, 1024
+	default:
+		return nil, ErrorUnknownObfuscation
+	}
+
+	res := append([]byte(nil), data...)
+	for i := 0; i < n && i < len(res); i++ {
+		res[i] ^= mask[i%len(mask)]
+	}
+
+	return res, nil
+}
+
+// adobeKey returns the 16 bytes of the UUID, given with or without the
+// urn:uuid: prefix.
+func adobeKey(id string) ([]byte, error) {
+	id = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(id)), "urn:uuid:")
+	if len(id) != 36 || strings.Count(id, "-") != 4 {
+		return nil, ErrorInvalidUUID
+	}
+	key, err := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+	if err != nil || len(key) != 16 {
+		return nil, ErrorInvalidUUID
+	}
+	return key, nil
+}
+
+// WriteEncryption writes META-INF/encryption.xml listing the files.
+func WriteEncryption(w io.Writer, files []EncryptedFile) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">`)
+	for _, f := range files {
+		buf.WriteString(`<enc:EncryptedData><enc:EncryptionMethod Algorithm="`)
+		xml.EscapeText(&buf, []byte(f.Algorithm))
+		buf.WriteString(`"/><enc:CipherData><enc:CipherReference URI="`)
+		xml.EscapeText(&buf, []byte(f.URI))
+		buf.WriteString(`"/></enc:CipherData></enc:EncryptedData>`)
+	}
+	buf.WriteString(`</encryption>`)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// epubParseEncryption returns the obfuscation algorithm of the obfuscated
+// fonts listed in META-INF/encryption.xml, by zip entry name. Encrypted
+// files are left out: they can't be read anyway.
+func epubParseEncryption(files map[string]*zip.File) (map[string]string, error) {
+	var enc epubEncryption
+
+	if _, ok := files["META-INF/encryption.xml"]; !ok {
+		return nil, nil
+	}
+	data, err := epubReadZipEntry(files, "META-INF/encryption.xml")
+	if err != nil {
+		return nil, err
+	}
+	if err = xml.Unmarshal(data, &enc); err != nil {
+		return nil, fmt.Errorf("invalid encryption.xml: %w", err)
+	}
+
+	res := map[string]string{}
+	for _, d := range enc.Data {
+		uri := d.Ref.URI
+		if u, err := url.PathUnescape(uri); err == nil {
+			uri = u
+		}
+		if d.Method.Algorithm == ObfuscationIDPF || d.Method.Algorithm == ObfuscationAdobe {
+			res[uri] = d.Method.Algorithm
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,111 @@
+package ugarit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// PageBreakOptions configures the AddPageBreak method of the epub30 and
+// epub20 books.
+type PageBreakOptions struct {
+	Insert bool   // inserts an empty page break span, with the page break id, into the page
+	Before string // id of the element the span is inserted before; the start of the body if empty
+}
+
+// PageListGenerator is implemented by the index generators able to emit
+// the list of the print pages. AddTOC passes them the page breaks
+// registered with AddPageBreak.
+type PageListGenerator interface {
+	// AddPageTarget must append the page to the page list. The page is
+	// provided as a link (the HTML 'A' element) with the href attribute
+	// pointing to the page break and the page label as text content.
+	AddPageTarget(item *html.Node) error
+}
+
+// InsertPageBreak inserts an empty span with the given id into the XHTML
+// page, before the element whose id is before or, if before is "", at the
+// start of the body. The rest of the page is kept untouched. EPUB 3 spans
+// are marked as pagebreak, with label as their accessible name; EPUB 2 ones
+// only hold label as their title.
+func InsertPageBreak(page []byte, id, label, before string, epub3 bool) ([]byte, error) {
+	var span bytes.Buffer
+	var stack []bool // open elements, whether they declare the epub namespace
+	var epubNS bool
+	var off int64
+
+	dec := xml.NewDecoder(bytes.NewReader(page))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	// The span may only use the epub prefix its ancestors declare
+	declared := func() bool {
+		for _, decl := range stack {
+			if decl {
+				return true
+			}
+		}
+		return false
+	}
+
+	off = -1
+	for off < 0 {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			Goose.Logf(1, "InsertPageBreak: no place for the page break %s before %q\n", id, before)
+			return nil, ErrorElementNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			decl := false
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns" && a.Name.Local == "epub":
+					decl = true
+				case before != "" && a.Name.Space == "" && a.Name.Local == "id" && a.Value == before:
+					off, epubNS = start, declared()
+				}
+			}
+			stack = append(stack, decl)
+			if before == "" && t.Name.Local == "body" {
+				off, epubNS = dec.InputOffset(), declared()
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	span.WriteString(`<span`)
+	if epub3 {
+		if !epubNS {
+			span.WriteString(` xmlns:epub="http://www.idpf.org/2007/ops"`)
+		}
+		span.WriteString(` epub:type="pagebreak" role="doc-pagebreak"`)
+	}
+	span.WriteString(` id="`)
+	xml.EscapeText(&span, []byte(id))
+	if epub3 {
+		span.WriteString(`" aria-label="`)
+	} else {
+		span.WriteString(`" title="`)
+	}
+	xml.EscapeText(&span, []byte(label))
+	span.WriteString(`"></span>`)
+
+	res := make([]byte, 0, len(page)+span.Len())
+	res = append(res, page[:off]...)
+	res = append(res, span.Bytes()...)
+	res = append(res, page[off:]...)
+
+	return res, nil
+}
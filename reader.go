@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"os"
 	"path"
 	"strings"
 
@@ -23,9 +24,28 @@ var Goose goose.Alert
 
 // DocMeta holds metadata for a document entry in an epub.
 type DocMeta struct {
-	Path     string // OPF-relative href of the document
-	MimeType string
-	InTOC    bool // true if the document appears in the Table of Contents
+	Path         string // OPF-relative href of the document
+	MimeType     string
+	InTOC        bool     // true if the document appears in the Table of Contents
+	ID           string   // manifest id of the document
+	Properties   []string // manifest properties (nav, cover-image, scripted...)
+	MediaOverlay string   // manifest id of the item's media overlay, if any
+	Obfuscation  string   // font obfuscation algorithm (ObfuscationIDPF, ObfuscationAdobe), if any
+}
+
+// GuideRef is a reference of the EPUB 2 guide.
+type GuideRef struct {
+	Type  string // cover, toc, title-page, text...
+	Title string
+	Href  string // OPF-relative href, fragment included
+}
+
+// SpineItem is one entry of the reading order declared in the OPF spine.
+type SpineItem struct {
+	Doc        DocMeta
+	ID         string   // itemref id, if any
+	Linear     bool     // false when the itemref has linear="no"
+	Properties []string // page-spread-left, rendition:layout-pre-paginated...
 }
 
 // BookReader provides read access to an epub file.
@@ -46,12 +66,67 @@ type BookReader interface {
 	// Docs returns an iterator over all items in the epub manifest.
 	// Key is the item title (from TOC) or its manifest ID; value is DocMeta.
 	Docs() iter.Seq2[string, DocMeta]
+
+	// Spine returns an iterator over the documents in reading order.
+	// Key is the item title (from TOC) or its manifest ID; value is the
+	// spine entry.
+	Spine() iter.Seq2[string, SpineItem]
+
+	// PageProgression returns the spine page-progression-direction
+	// ("ltr", "rtl" or "" when not declared).
+	PageProgression() string
+
+	// TOC returns the table of contents as an ordered tree. The root
+	// node holds the top level entries.
+	TOC() *TOCNode
+
+	// Metadata returns the package metadata (titles, creators,
+	// identifiers, <meta> entries...) with EPUB 3 refines resolved.
+	Metadata() Metadata
+
+	// Item returns the manifest item with the given id.
+	Item(id string) (DocMeta, bool)
+
+	// ItemByPath returns the manifest item stored at the given
+	// OPF-relative path. A fragment, if any, is ignored.
+	ItemByPath(path string) (DocMeta, bool)
+
+	// Resolve resolves href, as found inside the document at the
+	// OPF-relative path fromDoc, into an OPF-relative path. Fragments
+	// are kept and external URLs are returned untouched. An empty
+	// fromDoc resolves href relative to the OPF folder.
+	Resolve(fromDoc, href string) string
+
+	// Guide returns the references of the EPUB 2 guide, if any.
+	Guide() []GuideRef
+
+	// Cover returns the cover image and a reader for its contents.
+	// It is looked for, in order, in the manifest item with the
+	// cover-image property, the item named by <meta name="cover">, the
+	// guide reference of type cover and, when those name an XHTML page,
+	// the first image that page shows. A cover page with an inline SVG
+	// and no referenced image is returned itself.
+	// Returns ErrorCoverNotFound when the book declares no cover.
+	Cover() (DocMeta, io.Reader, error)
+
+	// FS returns a read-only file system view of the archive, rooted at
+	// the OPF folder (where manifest hrefs are valid names) if opfRoot is
+	// true, at the archive root otherwise.
+	FS(opfRoot bool) *BookFS
+
+	// Validate checks the book structure, returning the problems found,
+	// as epubcheck would report them. See Finding.
+	Validate() []Finding
+
+	// Close releases the resources held by the reader. Readers obtained
+	// from OpenFile close their file; the others have nothing to release.
+	Close() error
 }
 
 // --- internal XML structures for epub parsing ---
 
 type epubContainerXML struct {
-	XMLName   xml.Name              `xml:"container"`
+	XMLName   xml.Name                `xml:"container"`
 	Rootfiles []epubContainerRootfile `xml:"rootfiles>rootfile"`
 }
 
@@ -61,21 +136,42 @@ type epubContainerRootfile struct {
 }
 
 type epubOPFPackage struct {
-	XMLName  xml.Name         `xml:"package"`
-	Version  string           `xml:"version,attr"`
-	Manifest []epubOPFItem    `xml:"manifest>item"`
-	Spine    epubOPFSpine     `xml:"spine"`
+	XMLName          xml.Name        `xml:"package"`
+	Version          string          `xml:"version,attr"`
+	Prefix           string          `xml:"prefix,attr"`
+	UniqueIdentifier string          `xml:"unique-identifier,attr"`
+	Metadata         epubOPFMetadata `xml:"metadata"`
+	Manifest         []epubOPFItem   `xml:"manifest>item"`
+	Spine            epubOPFSpine    `xml:"spine"`
+	Guide            []epubOPFRef    `xml:"guide>reference"`
+}
+
+type epubOPFRef struct {
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr"`
+	Href  string `xml:"href,attr"`
 }
 
 type epubOPFItem struct {
-	ID         string `xml:"id,attr"`
-	Href       string `xml:"href,attr"`
-	MediaType  string `xml:"media-type,attr"`
-	Properties string `xml:"properties,attr"`
+	ID           string `xml:"id,attr"`
+	Href         string `xml:"href,attr"`
+	MediaType    string `xml:"media-type,attr"`
+	Properties   string `xml:"properties,attr"`
+	MediaOverlay string `xml:"media-overlay,attr"`
+	Fallback     string `xml:"fallback,attr"`
 }
 
 type epubOPFSpine struct {
-	Toc string `xml:"toc,attr"`
+	Toc             string           `xml:"toc,attr"`
+	PageProgression string           `xml:"page-progression-direction,attr"`
+	Itemrefs        []epubOPFItemref `xml:"itemref"`
+}
+
+type epubOPFItemref struct {
+	IDRef      string `xml:"idref,attr"`
+	ID         string `xml:"id,attr"`
+	Linear     string `xml:"linear,attr"`
+	Properties string `xml:"properties,attr"`
 }
 
 type epubNCX struct {
@@ -84,8 +180,10 @@ type epubNCX struct {
 }
 
 type epubNavPoint struct {
-	Label   string `xml:"navLabel>text"`
-	Content struct {
+	ID        string `xml:"id,attr"`
+	PlayOrder string `xml:"playOrder,attr"`
+	Label     string `xml:"navLabel>text"`
+	Content   struct {
 		Src string `xml:"src,attr"`
 	} `xml:"content"`
 	Points []epubNavPoint `xml:"navPoint"`
@@ -99,16 +197,33 @@ type epubDocEntry struct {
 	meta    DocMeta // Path is OPF-relative
 }
 
+type epubSpineEntry struct {
+	title string
+	item  SpineItem
+}
+
 type epubReader struct {
-	zr         *zip.Reader
-	rootFolder string
-	entries    []epubDocEntry
-	byZipPath  map[string]int // zipPath -> index in entries
+	files           map[string]*zip.File // zip entry name -> entry
+	archive         []*zip.File          // zip entries in archive order
+	opfPath         string               // zip entry name of the OPF
+	pkg             *epubOPFPackage
+	rootFolder      string
+	entries         []epubDocEntry
+	byZipPath       map[string]int // zipPath -> index in entries
+	byID            map[string]int // manifest id -> index in entries
+	spine           []epubSpineEntry
+	toc             *TOCNode
+	pageProgression string
+	metadata        Metadata
+	guide           []epubOPFRef
+	obfuscated      map[string]string // zip entry name -> font obfuscation algorithm
+	closer          io.Closer         // set when the reader owns the underlying file
 }
 
 // NewReader creates a BookReader by reading and parsing the epub from r.
 // Because epub files are ZIP archives (requiring random access), the entire
-// content of r is buffered into memory.
+// content of r is buffered into memory. Use NewReaderAt or OpenFile to
+// avoid it.
 func NewReader(r io.Reader) (BookReader, error) {
 	Goose.Logf(3, "NewReader: reading epub content into memory\n")
 
@@ -118,32 +233,84 @@ func NewReader(r io.Reader) (BookReader, error) {
 		return nil, err
 	}
 
-	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	return NewReaderAt(bytes.NewReader(data), int64(len(data)))
+}
+
+// OpenFile opens the epub file at filename and creates a BookReader over it.
+// Archive entries are read from disk on demand, so memory usage does not
+// grow with the size of the book. The file is kept open until Close.
+func OpenFile(filename string) (BookReader, error) {
+	Goose.Logf(3, "OpenFile: %s\n", filename)
+
+	f, err := os.Open(filename)
 	if err != nil {
-		Goose.Logf(1, "NewReader: error opening epub as zip: %s\n", err)
+		Goose.Logf(1, "OpenFile: error opening %s: %s\n", filename, err)
 		return nil, err
 	}
 
+	st, err := f.Stat()
+	if err != nil {
+		Goose.Logf(1, "OpenFile: error stating %s: %s\n", filename, err)
+		f.Close()
+		return nil, err
+	}
+
+	br, err := NewReaderAt(f, st.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	br.(*epubReader).closer = f
+	return br, nil
+}
+
+// NewReaderAt creates a BookReader over the size bytes of epub content
+// available through r. Only the archive directory and the package
+// documents are read upfront; everything else is read from r on demand,
+// so r must stay usable while the BookReader is in use. Close does not
+// close r.
+func NewReaderAt(r io.ReaderAt, size int64) (BookReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		Goose.Logf(1, "NewReaderAt: error opening epub as zip: %s\n", err)
+		return nil, err
+	}
+
+	// Index the archive once, so that lookups don't scan zr.File.
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		if _, ok := files[f.Name]; !ok {
+			files[f.Name] = f
+		}
+	}
+
 	// Step 1: locate the OPF rootfile via META-INF/container.xml
-	rootfilePath, err := epubParseContainerXML(zr)
+	rootfilePath, err := epubParseContainerXML(files)
 	if err != nil {
 		return nil, err
 	}
-	Goose.Logf(3, "NewReader: OPF rootfile: %s\n", rootfilePath)
+	Goose.Logf(3, "NewReaderAt: OPF rootfile: %s\n", rootfilePath)
 
 	// The root folder is the directory portion of the rootfile path.
 	rootFolder := path.Dir(rootfilePath)
 	if rootFolder == "." {
 		rootFolder = ""
 	}
-	Goose.Logf(4, "NewReader: root folder: %q\n", rootFolder)
+	Goose.Logf(4, "NewReaderAt: root folder: %q\n", rootFolder)
 
 	// Step 2: parse the OPF package document
-	pkg, err := epubParseOPF(zr, rootfilePath)
+	pkg, err := epubParseOPF(files, rootfilePath)
 	if err != nil {
 		return nil, err
 	}
-	Goose.Logf(2, "NewReader: epub %s — %d manifest items\n", pkg.Version, len(pkg.Manifest))
+	Goose.Logf(2, "NewReaderAt: epub %s — %d manifest items\n", pkg.Version, len(pkg.Manifest))
+
+	// Obfuscated fonts are de-obfuscated when read
+	obfuscated, err := epubParseEncryption(files)
+	if err != nil {
+		Goose.Logf(1, "NewReaderAt: %s\n", err)
+	}
 
 	// Build manifest ID lookup
 	byID := make(map[string]epubOPFItem, len(pkg.Manifest))
@@ -151,50 +318,52 @@ func NewReader(r io.Reader) (BookReader, error) {
 		byID[item.ID] = item
 	}
 
-	// Step 3: discover and parse the TOC to obtain title mappings.
-	// tocTitles maps OPF-relative href (fragment stripped) -> display title.
-	tocTitles := map[string]string{}
+	// Step 3: discover and parse the TOC tree.
+	toc := &TOCNode{}
 
 	// Try epub3 navigation document first (properties contains "nav").
 	if navID := epubFindNavItemID(pkg.Manifest); navID != "" {
 		navItem := byID[navID]
 		navZipPath := epubZipPath(rootFolder, navItem.Href)
-		navDir := path.Dir(navItem.Href)
-		if navDir == "." {
-			navDir = ""
-		}
-		Goose.Logf(3, "NewReader: epub3 nav document: %s\n", navZipPath)
-		titles, err2 := epubParseNavXHTML(zr, navZipPath, navDir)
+		Goose.Logf(3, "NewReaderAt: epub3 nav document: %s\n", navZipPath)
+		tree, err2 := epubParseNavXHTML(files, navZipPath, navItem.Href)
 		if err2 != nil {
-			Goose.Logf(1, "NewReader: error parsing epub3 nav: %s\n", err2)
+			Goose.Logf(1, "NewReaderAt: error parsing epub3 nav: %s\n", err2)
 		} else {
-			tocTitles = titles
+			toc = tree
 		}
 	}
 
-	// Fall back to epub2 NCX when no epub3 nav titles were found.
-	if len(tocTitles) == 0 && pkg.Spine.Toc != "" {
+	// Fall back to epub2 NCX when no epub3 nav entries were found.
+	if toc.TOCLen() == 0 && pkg.Spine.Toc != "" {
 		if ncxItem, ok := byID[pkg.Spine.Toc]; ok {
 			ncxZipPath := epubZipPath(rootFolder, ncxItem.Href)
-			ncxDir := path.Dir(ncxItem.Href)
-			if ncxDir == "." {
-				ncxDir = ""
-			}
-			Goose.Logf(3, "NewReader: epub2 NCX: %s\n", ncxZipPath)
-			titles, err2 := epubParseNCX(zr, ncxZipPath, ncxDir)
+			Goose.Logf(3, "NewReaderAt: epub2 NCX: %s\n", ncxZipPath)
+			tree, err2 := epubParseNCX(files, ncxZipPath, ncxItem.Href)
 			if err2 != nil {
-				Goose.Logf(1, "NewReader: error parsing epub2 NCX: %s\n", err2)
+				Goose.Logf(1, "NewReaderAt: error parsing epub2 NCX: %s\n", err2)
 			} else {
-				tocTitles = titles
+				toc = tree
 			}
 		}
 	}
 
-	Goose.Logf(2, "NewReader: %d TOC entries resolved\n", len(tocTitles))
+	// tocTitles maps OPF-relative href (fragment stripped) -> display title.
+	// When several entries point into the same file, the first one names it.
+	tocTitles := map[string]string{}
+	toc.walk(func(n *TOCNode) {
+		href := epubStripFragment(n.Href)
+		if _, ok := tocTitles[href]; !ok && href != "" && n.Title != "" {
+			tocTitles[href] = n.Title
+		}
+	})
+
+	Goose.Logf(2, "NewReaderAt: %d TOC entries resolved\n", len(tocTitles))
 
 	// Step 4: build the ordered entry list from the manifest.
 	entries := make([]epubDocEntry, 0, len(pkg.Manifest))
 	byZipPath := make(map[string]int, len(pkg.Manifest))
+	byEntryID := make(map[string]int, len(pkg.Manifest))
 
 	for _, mi := range pkg.Manifest {
 		zp := epubZipPath(rootFolder, mi.Href)
@@ -202,7 +371,7 @@ func NewReader(r io.Reader) (BookReader, error) {
 		if !inTOC {
 			title = mi.ID
 		}
-		Goose.Logf(5, "NewReader: item id=%s href=%s inTOC=%v title=%q\n",
+		Goose.Logf(5, "NewReaderAt: item id=%s href=%s inTOC=%v title=%q\n",
 			mi.ID, mi.Href, inTOC, title)
 
 		idx := len(entries)
@@ -210,19 +379,60 @@ func NewReader(r io.Reader) (BookReader, error) {
 			title:   title,
 			zipPath: zp,
 			meta: DocMeta{
-				Path:     mi.Href,
-				MimeType: mi.MediaType,
-				InTOC:    inTOC,
+				Path:         mi.Href,
+				MimeType:     mi.MediaType,
+				InTOC:        inTOC,
+				ID:           mi.ID,
+				Properties:   strings.Fields(mi.Properties),
+				MediaOverlay: mi.MediaOverlay,
+				Obfuscation:  obfuscated[zp],
 			},
 		})
 		byZipPath[zp] = idx
+		byEntryID[mi.ID] = idx
+	}
+
+	toc.walk(func(n *TOCNode) {
+		if idx, ok := byZipPath[epubZipPath(rootFolder, epubStripFragment(n.Href))]; ok {
+			n.Doc = &entries[idx].meta
+		}
+	})
+
+	// Step 5: resolve the spine itemrefs against the manifest.
+	spine := make([]epubSpineEntry, 0, len(pkg.Spine.Itemrefs))
+	for _, ir := range pkg.Spine.Itemrefs {
+		idx, ok := byEntryID[ir.IDRef]
+		if !ok {
+			Goose.Logf(1, "NewReaderAt: spine itemref %q not in manifest\n", ir.IDRef)
+			continue
+		}
+		spine = append(spine, epubSpineEntry{
+			title: entries[idx].title,
+			item: SpineItem{
+				Doc:        entries[idx].meta,
+				ID:         ir.ID,
+				Linear:     ir.Linear != "no",
+				Properties: strings.Fields(ir.Properties),
+			},
+		})
 	}
+	Goose.Logf(2, "NewReaderAt: %d spine items\n", len(spine))
 
 	return &epubReader{
-		zr:         zr,
-		rootFolder: rootFolder,
-		entries:    entries,
-		byZipPath:  byZipPath,
+		files:           files,
+		archive:         zr.File,
+		opfPath:         rootfilePath,
+		pkg:             pkg,
+		rootFolder:      rootFolder,
+		entries:         entries,
+		byZipPath:       byZipPath,
+		byID:            byEntryID,
+		spine:           spine,
+		toc:             toc,
+		pageProgression: pkg.Spine.PageProgression,
+		metadata:        epubBuildMetadata(pkg),
+		guide:           pkg.Guide,
+		obfuscated:      obfuscated,
 	}, nil
 }
 
@@ -250,18 +460,91 @@ func (er *epubReader) Docs() iter.Seq2[string, DocMeta] {
 	}
 }
 
+// Spine returns an iterator over the documents in reading order.
+func (er *epubReader) Spine() iter.Seq2[string, SpineItem] {
+	return func(yield func(string, SpineItem) bool) {
+		for _, s := range er.spine {
+			if !yield(s.title, s.item) {
+				return
+			}
+		}
+	}
+}
+
+// PageProgression returns the spine page-progression-direction.
+func (er *epubReader) PageProgression() string {
+	return er.pageProgression
+}
+
+// TOC returns the table of contents tree.
+func (er *epubReader) TOC() *TOCNode {
+	return er.toc
+}
+
+// Metadata returns the package metadata parsed from the OPF document.
+func (er *epubReader) Metadata() Metadata {
+	return er.metadata
+}
+
+// Guide returns the references of the EPUB 2 guide.
+func (er *epubReader) Guide() []GuideRef {
+	refs := make([]GuideRef, len(er.guide))
+	for i, r := range er.guide {
+		refs[i] = GuideRef{Type: r.Type, Title: r.Title, Href: epubResolveLink("", r.Href)}
+	}
+	return refs
+}
+
+// Item returns the manifest item with the given id.
+func (er *epubReader) Item(id string) (DocMeta, bool) {
+	idx, ok := er.byID[id]
+	if !ok {
+		return DocMeta{}, false
+	}
+	return er.entries[idx].meta, true
+}
+
+// ItemByPath returns the manifest item stored at the OPF-relative path.
+func (er *epubReader) ItemByPath(docPath string) (DocMeta, bool) {
+	docPath = epubStripFragment(docPath)
+	if docPath == "" {
+		return DocMeta{}, false
+	}
+	idx, ok := er.byZipPath[epubZipPath(er.rootFolder, epubResolveHref("", docPath))]
+	if !ok {
+		return DocMeta{}, false
+	}
+	return er.entries[idx].meta, true
+}
+
+// Resolve resolves href, as found inside fromDoc, into an OPF-relative path.
+func (er *epubReader) Resolve(fromDoc, href string) string {
+	return epubResolveLink(fromDoc, href)
+}
+
+// Close closes the underlying file when the reader owns it.
+func (er *epubReader) Close() error {
+	if er.closer == nil {
+		return nil
+	}
+	Goose.Logf(3, "Close: closing epub file\n")
+	c := er.closer
+	er.closer = nil
+	return c.Close()
+}
+
 // DocReader returns an io.Reader for the document at the OPF-relative path.
 func (er *epubReader) DocReader(docPath string) (io.Reader, error) {
 	zp := epubZipPath(er.rootFolder, docPath)
 	Goose.Logf(4, "DocReader: %s (zip entry: %s)\n", docPath, zp)
 
-	f := epubFindZipFile(er.zr, zp)
-	if f == nil {
+	f, ok := er.files[zp]
+	if !ok {
 		Goose.Logf(1, "DocReader: not found in archive: %s\n", zp)
 		return nil, fmt.Errorf("document not found in epub: %s", docPath)
 	}
 
-	rc, err := f.Open()
+	rc, err := er.openEntry(f)
 	if err != nil {
 		Goose.Logf(1, "DocReader: error opening %s: %s\n", zp, err)
 		return nil, err
@@ -271,6 +554,38 @@ func (er *epubReader) DocReader(docPath string) (io.Reader, error) {
 	return rc, nil
 }
 
+// openEntry opens an archive entry for reading its contents, de-obfuscated
+// if it is an obfuscated font.
+func (er *epubReader) openEntry(f *zip.File) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	alg, ok := er.obfuscated[f.Name]
+	if err != nil || !ok {
+		return rc, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, id := range er.metadata.Identifiers {
+		ids = append(ids, id.Value)
+	}
+	key, err := ObfuscationKey(alg, er.metadata.Identifier().Value, ids)
+	if err != nil {
+		Goose.Logf(1, "openEntry: no key for %s: %s\n", f.Name, err)
+		return nil, err
+	}
+	data, err = Obfuscate(data, alg, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
 // Doc parses the document at the OPF-relative path and returns a *goquery.Document.
 func (er *epubReader) Doc(docPath string) (*goquery.Document, error) {
 	r, err := er.DocReader(docPath)
@@ -293,9 +608,9 @@ func (er *epubReader) Doc(docPath string) (*goquery.Document, error) {
 
 // --- internal helpers ---
 
-func epubReadZipEntry(zr *zip.Reader, name string) ([]byte, error) {
-	f := epubFindZipFile(zr, name)
-	if f == nil {
+func epubReadZipEntry(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
 		return nil, fmt.Errorf("entry not found in epub archive: %s", name)
 	}
 	rc, err := f.Open()
@@ -306,17 +621,8 @@ func epubReadZipEntry(zr *zip.Reader, name string) ([]byte, error) {
 	return io.ReadAll(rc)
 }
 
-func epubFindZipFile(zr *zip.Reader, name string) *zip.File {
-	for _, f := range zr.File {
-		if f.Name == name {
-			return f
-		}
-	}
-	return nil
-}
-
-func epubParseContainerXML(zr *zip.Reader) (string, error) {
-	data, err := epubReadZipEntry(zr, "META-INF/container.xml")
+func epubParseContainerXML(files map[string]*zip.File) (string, error) {
+	data, err := epubReadZipEntry(files, "META-INF/container.xml")
 	if err != nil {
 		return "", fmt.Errorf("invalid epub: %w", err)
 	}
@@ -330,8 +636,8 @@ func epubParseContainerXML(zr *zip.Reader) (string, error) {
 	return c.Rootfiles[0].FullPath, nil
 }
 
-func epubParseOPF(zr *zip.Reader, opfPath string) (*epubOPFPackage, error) {
-	data, err := epubReadZipEntry(zr, opfPath)
+func epubParseOPF(files map[string]*zip.File, opfPath string) (*epubOPFPackage, error) {
+	data, err := epubReadZipEntry(files, opfPath)
 	if err != nil {
 		return nil, fmt.Errorf("cannot read OPF file: %w", err)
 	}
@@ -355,69 +661,6 @@ func epubFindNavItemID(manifest []epubOPFItem) string {
 	return ""
 }
 
-// epubParseNavXHTML parses an epub3 nav XHTML file and returns a map from
-// OPF-relative href (without fragment) to display title.
-// navDir is the nav file's directory, relative to the OPF folder.
-func epubParseNavXHTML(zr *zip.Reader, zipPath, navDir string) (map[string]string, error) {
-	data, err := epubReadZipEntry(zr, zipPath)
-	if err != nil {
-		return nil, err
-	}
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, err
-	}
-
-	titles := map[string]string{}
-	doc.Find("nav a[href]").Each(func(_ int, a *goquery.Selection) {
-		href, _ := a.Attr("href")
-		href = epubStripFragment(href)
-		if href == "" {
-			return
-		}
-		resolved := epubResolveHref(navDir, href)
-		title := strings.TrimSpace(a.Text())
-		if title != "" && resolved != "" {
-			Goose.Logf(5, "epubParseNavXHTML: %s -> %q\n", resolved, title)
-			titles[resolved] = title
-		}
-	})
-
-	return titles, nil
-}
-
-// epubParseNCX parses an epub2 NCX file and returns a map from
-// OPF-relative href (without fragment) to display title.
-// ncxDir is the NCX file's directory, relative to the OPF folder.
-func epubParseNCX(zr *zip.Reader, zipPath, ncxDir string) (map[string]string, error) {
-	data, err := epubReadZipEntry(zr, zipPath)
-	if err != nil {
-		return nil, err
-	}
-	var ncx epubNCX
-	if err := xml.Unmarshal(data, &ncx); err != nil {
-		return nil, err
-	}
-	titles := map[string]string{}
-	epubCollectNavPoints(ncx.Points, ncxDir, titles)
-	return titles, nil
-}
-
-func epubCollectNavPoints(points []epubNavPoint, dir string, titles map[string]string) {
-	for _, p := range points {
-		src := epubStripFragment(p.Content.Src)
-		if src != "" {
-			resolved := epubResolveHref(dir, src)
-			title := strings.TrimSpace(p.Label)
-			if title != "" && resolved != "" {
-				Goose.Logf(5, "epubCollectNavPoints: %s -> %q\n", resolved, title)
-				titles[resolved] = title
-			}
-		}
-		epubCollectNavPoints(p.Points, dir, titles)
-	}
-}
-
 // epubStripFragment removes the URL fragment (#...) from href.
 func epubStripFragment(href string) string {
 	if i := strings.Index(href, "#"); i >= 0 {
@@ -438,9 +681,38 @@ func epubResolveHref(dir, href string) string {
 	return path.Clean(dir + "/" + href)
 }
 
+// epubResolveLink resolves href, as found inside the document at the
+// OPF-relative path fromDoc, keeping its fragment. External links are
+// returned untouched and a bare fragment points into fromDoc itself.
+func epubResolveLink(fromDoc, href string) string {
+	var frag string
+
+	if strings.Contains(href, "://") || strings.HasPrefix(href, "mailto:") {
+		return href
+	}
+
+	if i := strings.Index(href, "#"); i >= 0 {
+		frag = href[i:]
+		href = href[:i]
+	}
+
+	if href == "" {
+		return fromDoc + frag
+	}
+
+	dir := ""
+	if fromDoc != "" {
+		dir = path.Dir(fromDoc)
+	}
+
+	return epubResolveHref(dir, href) + frag
+}
+
 // epubZipPath builds the full zip-entry path from the OPF root folder and
-// an OPF-relative href.
+// an OPF-relative href. Hrefs are URLs, so they are percent-decoded, while
+// entry names are not; an invalid encoding is kept as it is.
 func epubZipPath(folder, href string) string {
+	href = UnescapeHref(href)
 	if folder == "" {
 		return href
 	}
@@ -0,0 +1,379 @@
+package ugarit_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/luisfurquim/ugarit"
+	"github.com/luisfurquim/ugarit/epub20"
+	"github.com/luisfurquim/ugarit/epub30"
+	"github.com/luisfurquim/ugarit/internal/testutil"
+)
+
+func TestReaderMetadata(t *testing.T) {
+	md := testutil.Book(t).Metadata()
+
+	if md.Version != "3.0" {
+		t.Errorf("version: got %q", md.Version)
+	}
+	if got := md.Title(); got != "The Title" {
+		t.Errorf("title: got %q", got)
+	}
+	if md.Titles[1].Lang != "en" {
+		t.Errorf("title lang: got %q", md.Titles[1].Lang)
+	}
+	if got := md.Identifier().Value; got != "urn:uuid:1b4e28ba-2fa1-11d2-883f-0016d3cca427" {
+		t.Errorf("unique identifier: got %q", got)
+	}
+	if got := md.Identifiers[0].Scheme; got != "15" {
+		t.Errorf("identifier scheme: got %q", got)
+	}
+
+	if len(md.Creators) != 1 {
+		t.Fatalf("creators: got %d", len(md.Creators))
+	}
+	c := md.Creators[0]
+	if c.Value != "Jane Doe" || c.Role != "aut" || c.FileAs != "Doe, Jane" {
+		t.Errorf("creator: got %+v", c)
+	}
+	// The alternate-script refines the role, which refines the creator.
+	if len(c.Refinements) != 2 || c.Refinements[0].Refinement("alternate-script") != "著者" {
+		t.Errorf("creator refines chain: got %+v", c.Refinements)
+	}
+
+	if len(md.Contributors) != 1 || md.Contributors[0].Role != "ill" || md.Contributors[0].FileAs != "Roe, Richard" {
+		t.Errorf("contributor: got %+v", md.Contributors)
+	}
+	if len(md.Subjects) != 1 || len(md.Descriptions) != 1 || len(md.Rights) != 1 {
+		t.Errorf("subject/description/rights: got %d/%d/%d", len(md.Subjects), len(md.Descriptions), len(md.Rights))
+	}
+	if len(md.Dates) != 1 || md.Dates[0].Event != "publication" {
+		t.Errorf("date: got %+v", md.Dates)
+	}
+	if len(md.Meta) != 7 {
+		t.Errorf("meta entries: got %d", len(md.Meta))
+	}
+}
+
+func TestReaderSpine(t *testing.T) {
+	var items []ugarit.SpineItem
+	var titles []string
+
+	br := testutil.Book(t)
+	for title, it := range br.Spine() {
+		titles = append(titles, title)
+		items = append(items, it)
+	}
+
+	if br.PageProgression() != "rtl" {
+		t.Errorf("page progression: got %q", br.PageProgression())
+	}
+	if len(items) != 2 {
+		t.Fatalf("spine items: got %d", len(items))
+	}
+	if items[0].Doc.Path != "text/ch1.xhtml" || items[0].ID != "s1" || !items[0].Linear || titles[0] != "Chapter 1" {
+		t.Errorf("first spine item: got %q %+v", titles[0], items[0])
+	}
+	if len(items[0].Properties) != 2 || items[0].Properties[0] != "page-spread-right" {
+		t.Errorf("spine properties: got %v", items[0].Properties)
+	}
+	if items[1].Doc.ID != "nav" || items[1].Linear {
+		t.Errorf("second spine item: got %+v", items[1])
+	}
+}
+
+func TestReaderTOC(t *testing.T) {
+	var toc ugarit.TOC
+
+	br := testutil.Book(t)
+	root := br.TOC()
+	toc = root
+
+	if toc.TOCLen() != 1 {
+		t.Fatalf("top level entries: got %d", toc.TOCLen())
+	}
+	ch := root.Children[0]
+	if ch.Title != "Chapter 1" || ch.ID != "n1" || ch.Depth != 1 || ch.PlayOrder != 1 {
+		t.Errorf("chapter: got %+v", ch)
+	}
+	if ch.Doc == nil || ch.Doc.ID != "ch1" {
+		t.Errorf("chapter document: got %+v", ch.Doc)
+	}
+	if ch.TOCLen() != 2 {
+		t.Fatalf("sections: got %d", ch.TOCLen())
+	}
+
+	sec := ch.TOCChild(0)
+	if sec.ItemTitle() != "Section 1.1" || sec.ContentRef() != "text/ch1.xhtml#s1" {
+		t.Errorf("section: got %q %q", sec.ItemTitle(), sec.ContentRef())
+	}
+	if s := ch.Children[0]; s.Fragment() != "s1" || s.Doc == nil || s.Depth != 2 {
+		t.Errorf("section node: got %+v", s)
+	}
+
+	if s := ch.Children[1]; s.Href != "" || s.Doc != nil || len(s.Children) != 1 || s.Children[0].Href != "http://example.com/x" {
+		t.Errorf("unlinked section: got %+v", s)
+	}
+
+	// The chapter file is named after its first TOC entry; landmarks
+	// do not count as TOC entries.
+	for title, dm := range br.Index() {
+		if dm.ID != "ch1" || title != "Chapter 1" {
+			t.Errorf("index: got %q %+v", title, dm)
+		}
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "test.epub")
+	if err := os.WriteFile(fname, testutil.Epub(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	br, err := ugarit.OpenFile(fname)
+	if err != nil {
+		t.Fatalf("OpenFile: %s", err)
+	}
+
+	if got := br.Metadata().Title(); got != "The Title" {
+		t.Errorf("title: got %q", got)
+	}
+
+	r, err := br.DocReader("img/cover.png")
+	if err != nil {
+		t.Fatalf("DocReader: %s", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "PNG" {
+		t.Errorf("DocReader content: got %q, %v", data, err)
+	}
+
+	if err = br.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+	if _, err = br.DocReader("img/cover.png"); err == nil {
+		t.Errorf("DocReader after Close: expected an error")
+	}
+}
+
+func TestReaderLookup(t *testing.T) {
+	br := testutil.Book(t)
+
+	if dm, ok := br.Item("img"); !ok || dm.Path != "img/cover.png" || dm.MimeType != "image/png" {
+		t.Errorf("Item: got %+v, %v", dm, ok)
+	}
+	if _, ok := br.Item("nope"); ok {
+		t.Errorf("Item: unexpected hit for unknown id")
+	}
+	if dm, ok := br.ItemByPath("text/../text/ch1.xhtml#s1"); !ok || dm.ID != "ch1" {
+		t.Errorf("ItemByPath: got %+v, %v", dm, ok)
+	}
+
+	for _, c := range []struct{ from, href, want string }{
+		{"text/ch1.xhtml", "../img/cover.png", "img/cover.png"},
+		{"text/ch1.xhtml", "#s1", "text/ch1.xhtml#s1"},
+		{"text/ch1.xhtml", "ch2.xhtml#top", "text/ch2.xhtml#top"},
+		{"text/ch1.xhtml", "http://example.com/a.png", "http://example.com/a.png"},
+		{"", "nav.xhtml", "nav.xhtml"},
+	} {
+		if got := br.Resolve(c.from, c.href); got != c.want {
+			t.Errorf("Resolve(%q, %q): got %q, want %q", c.from, c.href, got, c.want)
+		}
+	}
+}
+
+func TestReaderCover(t *testing.T) {
+	var buf3, buf2 testutil.BufCloser
+
+	b3, err := epub30.New(&buf3, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub30.Signature{}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = b3.AddCover("img/front.png", "image/png", strings.NewReader("PNG3"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = b3.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b2, err := epub20.New(&buf2, []string{"T"}, []string{"en"}, []string{"id"}, nil, nil, nil, epub20.Signature{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = b2.AddCover("front.jpg", "image/jpeg", strings.NewReader("JPG2"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = b2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Guide only, with the image in an SVG wrapper page.
+	guideOnly := testutil.MkEpub(t, [][2]string{
+		{"META-INF/container.xml", testutil.Container},
+		{"OEBPS/content.opf", `<package version="2.0" xmlns="http://www.idpf.org/2007/opf">
+ <metadata/>
+ <manifest>
+  <item id="cp" href="text/cover.xhtml" media-type="application/xhtml+xml"/>
+  <item id="ci" href="images/c.gif" media-type="image/gif"/>
+ </manifest>
+ <spine><itemref idref="cp"/></spine>
+ <guide><reference type="cover" href="text/cover.xhtml" title="Cover"/></guide>
+</package>`},
+		{"OEBPS/text/cover.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:xlink="http://www.w3.org/1999/xlink"><body>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><image width="10" height="10" xlink:href="../images/c.gif"/></svg>
+</body></html>`},
+		{"OEBPS/images/c.gif", "GIF"},
+	})
+
+	for _, c := range []struct {
+		name, path, content string
+		data                []byte
+	}{
+		{"epub30", "img/front.png", "PNG3", buf3.Bytes()},
+		{"epub20", "front.jpg", "JPG2", buf2.Bytes()},
+		{"guide", "images/c.gif", "GIF", guideOnly},
+		{"cover-image", "img/cover.png", "PNG", testutil.Epub(t)},
+	} {
+		br, err := ugarit.NewReader(bytes.NewReader(c.data))
+		if err != nil {
+			t.Fatalf("%s: NewReader: %s", c.name, err)
+		}
+		dm, r, err := br.Cover()
+		if err != nil {
+			t.Errorf("%s: Cover: %s", c.name, err)
+			continue
+		}
+		data, _ := io.ReadAll(r)
+		if dm.Path != c.path || string(data) != c.content {
+			t.Errorf("%s: Cover: got %s %q", c.name, dm.Path, data)
+		}
+	}
+}
+
+func TestReaderFS(t *testing.T) {
+	br := testutil.Book(t)
+
+	if err := fstest.TestFS(br.FS(false), "mimetype", "META-INF/container.xml", "OEBPS/text/ch1.xhtml", "OEBPS/img/cover.png"); err != nil {
+		t.Errorf("archive root: %s", err)
+	}
+
+	fsys := br.FS(true)
+	if err := fstest.TestFS(fsys, "content.opf", "nav.xhtml", "text/ch1.xhtml", "img/cover.png"); err != nil {
+		t.Errorf("OPF root: %s", err)
+	}
+
+	var names []string
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		names = append(names, name)
+		return err
+	})
+	if got := strings.Join(names, " "); got != ". content.opf img img/cover.png nav.xhtml text text/ch1.xhtml" {
+		t.Errorf("WalkDir: got %q", got)
+	}
+
+	// http.FileServer needs seekable files
+	rec := httptest.NewRecorder()
+	http.FileServer(http.FS(fsys)).ServeHTTP(rec, httptest.NewRequest("GET", "/text/ch1.xhtml", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != testutil.Chapter {
+		t.Errorf("FileServer: got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	codes := func(findings []ugarit.Finding) map[string]int {
+		res := map[string]int{}
+		for _, f := range findings {
+			if f.Severity >= ugarit.SeverityError {
+				res[f.Code]++
+			}
+		}
+		return res
+	}
+
+	// A broken book, with the mimetype entry last
+	opf := `<?xml version="1.0" encoding="UTF-8"?>
+<package version="3.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="uid">
+ <metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:identifier id="uid">x</dc:identifier></metadata>
+ <manifest>
+  <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+  <item id="ch1" href="ch2.xhtml" media-type="application/xhtml+xml" properties="mathml"/>
+  <item id="gone" href="gone.png" media-type="image/png"/>
+  <item id="txt" href="a.txt" media-type="text/plain"/>
+  <item id="sp" href="a%20b.xhtml" media-type="application/xhtml+xml"/>
+ </manifest>
+ <spine><itemref idref="ch1"/><itemref idref="txt"/><itemref idref="nope"/><itemref idref="ch1"/><itemref idref="sp"/></spine>
+</package>`
+	ch1 := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml"><head><script src="x.js"/></head>
+<body id="a"><p id="a"/><a href="ch2.xhtml#nofrag">x</a><a href="ch2.xhtml#here">y</a><img src="extra.png"/><a href="missing.xhtml">z</a></body></html>`
+	ch2 := `<html xmlns="http://www.w3.org/1999/xhtml"><body><p id="here">&nbsp;</p><a href="a%20b.xhtml#sp">w</a></body></html>`
+
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	for _, f := range [][2]string{
+		{"META-INF/container.xml", testutil.Container},
+		{"OEBPS/content.opf", opf},
+		{"OEBPS/ch1.xhtml", ch1},
+		{"OEBPS/ch2.xhtml", ch2},
+		{"OEBPS/a.txt", "text"},
+		{"OEBPS/extra.png", "PNG"},
+		{"OEBPS/a b.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body id="sp"/></html>`},
+		{"mimetype", "application/epub+zip"},
+	} {
+		w, err := zw.Create(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f[1]))
+	}
+	zw.Close()
+
+	br, err := ugarit.NewReader(bytes.NewReader(zbuf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := br.Validate()
+	got := codes(findings)
+	for code, n := range map[string]int{
+		ugarit.CodeMimetypeNotFirst:   1,
+		ugarit.CodeMimetypeContent:    1,
+		ugarit.CodeSchema:             3, // duplicate manifest id, duplicate doc id, no dcterms:modified
+		ugarit.CodeFileNotFound:       1,
+		ugarit.CodeSpineMediaType:     1,
+		ugarit.CodeSpineItemNotFound:  1,
+		ugarit.CodeSpineDuplicate:     1,
+		ugarit.CodeResourceNotFound:   2, // x.js, missing.xhtml
+		ugarit.CodeResourceUndeclared: 1,
+		ugarit.CodeFragmentNotFound:   1,
+		ugarit.CodePropertyMissing:    1, // scripted
+		ugarit.CodePropertyUnused:     1, // mathml
+	} {
+		if got[code] != n {
+			t.Errorf("%s: got %d, want %d", code, got[code], n)
+		}
+	}
+	if len(got) != 12 {
+		t.Errorf("findings: got %v", findings)
+	}
+
+	var undeclared bool
+	for _, f := range findings {
+		if f.Code == ugarit.CodeNotInManifest && f.Path == "OEBPS/extra.png" && f.Severity == ugarit.SeverityUsage {
+			undeclared = true
+		}
+	}
+	if !undeclared {
+		t.Errorf("undeclared entry not reported: %v", findings)
+	}
+}
+
+// failWriter fails every write.
@@ -0,0 +1,174 @@
+package ugarit
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// TOCNode is one entry of the table of contents of a parsed book, as read
+// from the EPUB 3 nav document or the EPUB 2 NCX. The root node returned by
+// BookReader.TOC has no title and holds the top level entries.
+// TOCNode implements TOCRef, so the tree can be walked the same way the
+// TOC of a book being written is.
+type TOCNode struct {
+	Title     string
+	Href      string   // OPF-relative href, fragment included
+	Doc       *DocMeta // document Href points to, nil if it is not in the manifest
+	ID        string   // nav anchor id or NCX navPoint id
+	PlayOrder int      // NCX playOrder; position in document order for nav
+	Depth     int      // 0 for the root, 1 for top level entries
+	Children  []*TOCNode
+
+	subSection SectionStyle
+}
+
+// TOCChild retrieves the Nth child of this TOC entry
+func (tn *TOCNode) TOCChild(n int) TOCRef {
+	if n >= 0 && n < len(tn.Children) {
+		return tn.Children[n]
+	}
+	return nil
+}
+
+// TOCLen retrieves the item count in this TOC section
+func (tn *TOCNode) TOCLen() int {
+	return len(tn.Children)
+}
+
+// ItemRef retrieves the reference ID of the TOC item
+func (tn *TOCNode) ItemRef() string {
+	return tn.ID
+}
+
+// ItemTitle retrieves the item title (label) as it appears in the TOC
+func (tn *TOCNode) ItemTitle() string {
+	return tn.Title
+}
+
+// ContentRef retrieves the OPF-relative href pointed by the TOC entry,
+// fragment included
+func (tn *TOCNode) ContentRef() string {
+	return tn.Href
+}
+
+// SubSectionStyle sets the object to style this TOC subsection
+func (tn *TOCNode) SubSectionStyle(sty SectionStyle) {
+	tn.subSection = sty
+}
+
+// Fragment returns the fragment part of Href, without the '#'.
+func (tn *TOCNode) Fragment() string {
+	if i := strings.Index(tn.Href, "#"); i >= 0 {
+		return tn.Href[i+1:]
+	}
+	return ""
+}
+
+// walk calls fn on every descendant of tn in document order.
+func (tn *TOCNode) walk(fn func(*TOCNode)) {
+	for _, c := range tn.Children {
+		fn(c)
+		c.walk(fn)
+	}
+}
+
+// epubParseNavXHTML parses the toc nav of an epub3 navigation document.
+// navHref is the nav file's path, relative to the OPF folder.
+func epubParseNavXHTML(files map[string]*zip.File, zipPath, navHref string) (*TOCNode, error) {
+	var nav *goquery.Selection
+	var order int
+
+	data, err := epubReadZipEntry(files, zipPath)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Landmarks and page-list are navs too; only the toc one is wanted.
+	doc.Find("nav").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		typ, _ := s.Attr("epub:type")
+		for _, t := range strings.Fields(typ) {
+			if t == "toc" {
+				nav = s
+				return false
+			}
+		}
+		return true
+	})
+	if nav == nil {
+		nav = doc.Find("nav").First()
+	}
+
+	root := &TOCNode{}
+	root.Children = epubCollectNavList(nav.ChildrenFiltered("ol").First(), navHref, 1, &order)
+	return root, nil
+}
+
+// epubCollectNavList converts the <li> entries of a nav <ol> into nodes.
+func epubCollectNavList(ol *goquery.Selection, navHref string, depth int, order *int) []*TOCNode {
+	var nodes []*TOCNode
+
+	ol.ChildrenFiltered("li").Each(func(_ int, li *goquery.Selection) {
+		label := li.ChildrenFiltered("a, span").First()
+		*order++
+		n := &TOCNode{
+			Title:     strings.TrimSpace(label.Text()),
+			ID:        label.AttrOr("id", li.AttrOr("id", "")),
+			PlayOrder: *order,
+			Depth:     depth,
+		}
+		if href, ok := label.Attr("href"); ok {
+			n.Href = epubResolveLink(navHref, href)
+		}
+		Goose.Logf(5, "epubCollectNavList: %s -> %q\n", n.Href, n.Title)
+		n.Children = epubCollectNavList(li.ChildrenFiltered("ol").First(), navHref, depth+1, order)
+		nodes = append(nodes, n)
+	})
+
+	return nodes
+}
+
+// epubParseNCX parses an epub2 NCX file.
+// ncxHref is the NCX file's path, relative to the OPF folder.
+func epubParseNCX(files map[string]*zip.File, zipPath, ncxHref string) (*TOCNode, error) {
+	data, err := epubReadZipEntry(files, zipPath)
+	if err != nil {
+		return nil, err
+	}
+	var ncx epubNCX
+	if err := xml.Unmarshal(data, &ncx); err != nil {
+		return nil, err
+	}
+	root := &TOCNode{}
+	root.Children = epubCollectNavPoints(ncx.Points, ncxHref, 1)
+	return root, nil
+}
+
+func epubCollectNavPoints(points []epubNavPoint, ncxHref string, depth int) []*TOCNode {
+	var nodes []*TOCNode
+
+	for _, p := range points {
+		n := &TOCNode{
+			Title: strings.TrimSpace(p.Label),
+			ID:    p.ID,
+			Depth: depth,
+		}
+		n.PlayOrder, _ = strconv.Atoi(p.PlayOrder)
+		if p.Content.Src != "" {
+			n.Href = epubResolveLink(ncxHref, p.Content.Src)
+		}
+		Goose.Logf(5, "epubCollectNavPoints: %s -> %q\n", n.Href, n.Title)
+		n.Children = epubCollectNavPoints(p.Points, ncxHref, depth+1)
+		nodes = append(nodes, n)
+	}
+
+	return nodes
+}
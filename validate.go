@@ -0,0 +1,446 @@
+package ugarit
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Severity is the severity of a validation finding, after epubcheck's.
+type Severity int
+
+const (
+	SeverityInfo    Severity = iota
+	SeverityUsage            // not an error, but a practice worth checking
+	SeverityWarning          // likely a problem for some reading systems
+	SeverityError            // the book is not valid
+	SeverityFatal            // the book could not be checked any further
+)
+
+// Finding is a problem found by Validate.
+type Finding struct {
+	Severity Severity
+	Code     string // epubcheck message id, e.g. "RSC-007"
+	Path     string // zip entry name of the offending file
+	Message  string
+}
+
+// Finding codes, named after the epubcheck message ids.
+const (
+	CodeMimetypeNotFirst   = "PKG-006" // the mimetype entry is missing or not the first one
+	CodeMimetypeContent    = "PKG-007" // the mimetype entry has wrong contents or is compressed
+	CodeFileNotFound       = "RSC-001" // a manifest item is missing from the archive
+	CodeSchema             = "RSC-005" // duplicate ids, missing dcterms:modified...
+	CodeParse              = "RSC-016" // a content document is not well-formed
+	CodeResourceNotFound   = "RSC-007" // a reference points to a file missing from the archive
+	CodeResourceUndeclared = "RSC-008" // a reference points to a file missing from the manifest
+	CodeFragmentNotFound   = "RSC-012" // a reference points to an id missing from its document
+	CodeNotInManifest      = "OPF-003" // an archive entry is missing from the manifest
+	CodePropertyMissing    = "OPF-014" // a manifest item lacks a property its content requires
+	CodePropertyUnused     = "OPF-015" // a manifest item declares a property its content does not require
+	CodeSpineDuplicate     = "OPF-034" // a manifest item is referenced by more than one spine itemref
+	CodeSpineMediaType     = "OPF-043" // a spine item is neither XHTML nor SVG, without fallback
+	CodeSpineItemNotFound  = "OPF-049" // a spine itemref names no manifest item
+)
+
+var severityNames = [...]string{"INFO", "USAGE", "WARNING", "ERROR", "FATAL"}
+
+// String returns the severity name as epubcheck prints it.
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// String formats the finding like an epubcheck message.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s(%s): %s: %s", f.Severity, f.Code, f.Path, f.Message)
+}
+
+// url() values and @import strings in CSS
+var epubCSSRefs = regexp.MustCompile(`url\(\s*["']?([^"')]+?)["']?\s*\)|@import\s+["']([^"']+)["']`)
+
+// epubDocRefs lists, for the elements referencing other files, the
+// attributes holding the references and whether they are resources (as
+// opposed to hyperlinks).
+var epubDocRefs = map[string]struct {
+	attrs    []string
+	resource bool
+}{
+	"a":      {[]string{"href"}, false},
+	"area":   {[]string{"href"}, false},
+	"link":   {[]string{"href"}, true},
+	"img":    {[]string{"src"}, true},
+	"script": {[]string{"src"}, true},
+	"iframe": {[]string{"src"}, true},
+	"embed":  {[]string{"src"}, true},
+	"object": {[]string{"data"}, true},
+	"video":  {[]string{"src", "poster"}, true},
+	"audio":  {[]string{"src"}, true},
+	"source": {[]string{"src"}, true},
+	"track":  {[]string{"src"}, true},
+	"image":  {[]string{"href", "xlink:href"}, true},
+	"use":    {[]string{"href", "xlink:href"}, false},
+}
+
+// epubDocScan holds what validation needs from a content document.
+type epubDocScan struct {
+	ids      map[string]bool
+	dups     []string // ids seen more than once
+	refs     []string // references, as written
+	props    map[string]bool
+	resource map[string]bool // refs which are resources
+}
+
+// Validate checks the archive, the package document and the content
+// documents, returning the problems found in archive order, then manifest
+// order.
+func (er *epubReader) Validate() []Finding {
+	var findings []Finding
+	var epub3 bool
+
+	add := func(sev Severity, code, path, format string, args ...interface{}) {
+		f := Finding{Severity: sev, Code: code, Path: path, Message: fmt.Sprintf(format, args...)}
+		Goose.Logf(3, "Validate: %s\n", f)
+		findings = append(findings, f)
+	}
+
+	epub3 = strings.HasPrefix(er.pkg.Version, "3")
+
+	// The archive: mimetype entry and undeclared entries
+	if len(er.archive) == 0 || er.archive[0].Name != "mimetype" {
+		add(SeverityError, CodeMimetypeNotFirst, "mimetype", "Mimetype file entry is missing or is not the first file in the archive.")
+	}
+	if f, ok := er.files["mimetype"]; ok {
+		data, err := epubReadZipEntry(er.files, "mimetype")
+		if err != nil || string(data) != "application/epub+zip" || f.Method != zip.Store {
+			add(SeverityError, CodeMimetypeContent, "mimetype", "Mimetype file should only contain the string \"application/epub+zip\" and should not be compressed.")
+		}
+	}
+
+	for _, f := range er.archive {
+		if strings.HasSuffix(f.Name, "/") || f.Name == "mimetype" || f.Name == er.opfPath || strings.HasPrefix(f.Name, "META-INF/") {
+			continue
+		}
+		if _, ok := er.byZipPath[f.Name]; !ok {
+			add(SeverityUsage, CodeNotInManifest, f.Name, "Item %q exists in the EPUB, but is not declared in the OPF manifest.", f.Name)
+		}
+	}
+
+	// The package document: ids, manifest and spine
+	ids := map[string]bool{}
+	checkID := func(id string) {
+		if id == "" {
+			return
+		}
+		if ids[id] {
+			add(SeverityError, CodeSchema, er.opfPath, "Duplicate ID %q.", id)
+		}
+		ids[id] = true
+	}
+	for _, el := range er.pkg.Metadata.Elements {
+		checkID(el.attr("id"))
+	}
+	for _, mi := range er.pkg.Manifest {
+		checkID(mi.ID)
+	}
+	for _, ir := range er.pkg.Spine.Itemrefs {
+		checkID(ir.ID)
+	}
+
+	if epub3 {
+		n := 0
+		for _, m := range er.metadata.Meta {
+			if m.Property == "dcterms:modified" && m.Refines == "" {
+				n++
+			}
+		}
+		if n != 1 {
+			add(SeverityError, CodeSchema, er.opfPath, "package dcterms:modified meta element must occur exactly once.")
+		}
+	}
+
+	for _, mi := range er.pkg.Manifest {
+		if strings.Contains(mi.Href, "://") {
+			continue
+		}
+		if zp := epubZipPath(er.rootFolder, mi.Href); er.files[zp] == nil {
+			add(SeverityError, CodeFileNotFound, zp, "File %q could not be found.", mi.Href)
+		}
+	}
+
+	inSpine := map[string]bool{}
+	for _, ir := range er.pkg.Spine.Itemrefs {
+		idx, ok := er.byID[ir.IDRef]
+		if !ok {
+			add(SeverityError, CodeSpineItemNotFound, er.opfPath, "Spine itemref %q is not found in the manifest.", ir.IDRef)
+			continue
+		}
+		if inSpine[ir.IDRef] {
+			add(SeverityError, CodeSpineDuplicate, er.opfPath, "The spine contains multiple references to the manifest item with id %q.", ir.IDRef)
+			continue
+		}
+		inSpine[ir.IDRef] = true
+		switch er.entries[idx].meta.MimeType {
+		case "application/xhtml+xml", "image/svg+xml":
+			continue
+		case "application/x-dtbook+xml", "text/x-oeb1-document":
+			if !epub3 {
+				continue
+			}
+		}
+		if er.pkg.Manifest[idx].Fallback == "" {
+			add(SeverityError, CodeSpineMediaType, er.entries[idx].zipPath, "Spine item with non-standard media-type %q with no fallback.", er.entries[idx].meta.MimeType)
+		}
+	}
+
+	// The content documents: references and properties
+	scans := map[string]*epubDocScan{}
+	for _, e := range er.entries {
+		var scan *epubDocScan
+
+		f, ok := er.files[e.zipPath]
+		if !ok {
+			continue
+		}
+		switch e.meta.MimeType {
+		case "application/xhtml+xml", "image/svg+xml":
+			var err error
+			scan, err = er.scanDoc(f, e.meta.MimeType == "image/svg+xml")
+			if err != nil {
+				add(SeverityFatal, CodeParse, e.zipPath, "Error while parsing file: %s", err)
+			}
+		case "text/css":
+			scan = er.scanCSS(f)
+		default:
+			continue
+		}
+		if scan != nil {
+			scans[e.zipPath] = scan
+		}
+	}
+
+	for _, e := range er.entries {
+		scan, ok := scans[e.zipPath]
+		if !ok {
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, ref := range scan.refs {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+
+			if strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "//") || epubHasScheme(ref) {
+				if scan.resource[ref] && (strings.HasPrefix(ref, "http:") || strings.HasPrefix(ref, "https:") || strings.HasPrefix(ref, "//")) {
+					scan.props["remote-resources"] = true
+				}
+				continue
+			}
+
+			link := epubResolveLink(e.meta.Path, ref)
+			target, frag := link, ""
+			if i := strings.Index(link, "#"); i >= 0 {
+				target, frag = link[:i], link[i+1:]
+			}
+			zp := epubZipPath(er.rootFolder, target)
+			if er.files[zp] == nil {
+				add(SeverityError, CodeResourceNotFound, e.zipPath, "Referenced resource %q could not be found in the EPUB.", ref)
+				continue
+			}
+			if _, ok := er.byZipPath[zp]; !ok {
+				add(SeverityError, CodeResourceUndeclared, e.zipPath, "Referenced resource %q is not declared in the OPF manifest.", ref)
+				continue
+			}
+			if ts, ok := scans[zp]; ok && frag != "" && ts.ids != nil && !ts.ids[frag] {
+				add(SeverityError, CodeFragmentNotFound, e.zipPath, "Fragment identifier is not defined in %q.", ref)
+			}
+		}
+
+		for _, id := range scan.dups {
+			add(SeverityError, CodeSchema, e.zipPath, "Duplicate ID %q.", id)
+		}
+
+		if !epub3 || e.meta.MimeType != "application/xhtml+xml" && e.meta.MimeType != "image/svg+xml" {
+			continue
+		}
+
+		declared := map[string]bool{}
+		for _, p := range e.meta.Properties {
+			declared[p] = true
+		}
+		for _, p := range []string{"scripted", "svg", "mathml", "remote-resources"} {
+			switch {
+			case scan.props[p] && !declared[p]:
+				add(SeverityError, CodePropertyMissing, e.zipPath, "The property %q should be declared in the OPF file.", p)
+			case !scan.props[p] && declared[p]:
+				add(SeverityError, CodePropertyUnused, e.zipPath, "The property %q should not be declared in the OPF file.", p)
+			}
+		}
+	}
+
+	Goose.Logf(2, "Validate: %d findings\n", len(findings))
+	return findings
+}
+
+// scanDoc collects the ids, references and content features of an XHTML
+// or SVG document. It returns an error when the document is not well-formed.
+func (er *epubReader) scanDoc(f *zip.File, svgDoc bool) (*epubDocScan, error) {
+	var depthSVG int
+	var inStyle bool
+
+	rc, err := er.openEntry(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	dec := xml.NewDecoder(rc)
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	scan := &epubDocScan{ids: map[string]bool{}, props: map[string]bool{}, resource: map[string]bool{}}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return scan, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "script":
+				scan.props["scripted"] = true
+			case "svg":
+				if depthSVG == 0 && !svgDoc {
+					scan.props["svg"] = true
+				}
+				depthSVG++
+			case "math":
+				scan.props["mathml"] = true
+			case "style":
+				inStyle = true
+			}
+
+			dr, isRef := epubDocRefs[t.Name.Local]
+			resource := dr.resource
+			if t.Name.Local == "link" {
+				resource = strings.Contains(epubAttr(t, "rel"), "stylesheet")
+			}
+
+			for _, a := range t.Attr {
+				key := a.Name.Local
+				switch a.Name.Space {
+				case "":
+				case "xlink", "http://www.w3.org/1999/xlink":
+					key = "xlink:" + key
+				default:
+					continue
+				}
+
+				switch {
+				case key == "id":
+					if scan.ids[a.Value] {
+						scan.dups = append(scan.dups, a.Value)
+					}
+					scan.ids[a.Value] = true
+				case key == "style":
+					scan.addCSSRefs([]byte(a.Value))
+				case isRef:
+					for _, name := range dr.attrs {
+						if key == name {
+							scan.addRef(a.Value, resource)
+						}
+					}
+				}
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "svg":
+				depthSVG--
+			case "style":
+				inStyle = false
+			}
+
+		case xml.CharData:
+			if inStyle {
+				scan.addCSSRefs(t)
+			}
+		}
+	}
+
+	return scan, nil
+}
+
+// scanCSS collects the references of a stylesheet.
+func (er *epubReader) scanCSS(f *zip.File) *epubDocScan {
+	rc, err := er.openEntry(f)
+	if err != nil {
+		return nil
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil
+	}
+
+	scan := &epubDocScan{props: map[string]bool{}, resource: map[string]bool{}}
+	scan.addCSSRefs(data)
+
+	return scan
+}
+
+// addCSSRefs adds the url() and @import references of css.
+func (scan *epubDocScan) addCSSRefs(css []byte) {
+	for _, m := range epubCSSRefs.FindAllSubmatch(css, -1) {
+		scan.addRef(string(m[1])+string(m[2]), true)
+	}
+}
+
+func (scan *epubDocScan) addRef(ref string, resource bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return
+	}
+	scan.refs = append(scan.refs, ref)
+	if resource {
+		scan.resource[ref] = true
+	}
+}
+
+// epubAttr returns the value of the named attribute of el.
+func epubAttr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// epubHasScheme tells whether ref starts with a URL scheme (http:, mailto:...).
+func epubHasScheme(ref string) bool {
+	for i, c := range ref {
+		switch {
+		case c == ':':
+			return i > 0
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return false
+}